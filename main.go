@@ -1,22 +1,113 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 
 	"github.com/oguna/gomigemo-experiments-2020/migemo"
+	"github.com/oguna/gomigemo-experiments-2020/migemo/defaultdict"
 )
 
+const usage = `usage: gomigemo-experiments-2020 [command] [arguments]
+
+commands:
+  verify [-dict FILE]    check that the dictionary is internally consistent
+  stats [-dict FILE] [-json]
+                         print sizes per component and trie shape statistics
+
+Without a command, prints the dictionary size and a sample query.
+If -dict is omitted, the embedded default dictionary is used.
+`
+
 func main() {
-	fp, err := os.Open("testdata/migemo-dict")
-	if err != nil {
-		panic(err)
+	if len(os.Args) < 2 {
+		demo()
+		return
+	}
+	switch os.Args[1] {
+	case "verify":
+		os.Exit(runVerify(os.Args[2:]))
+	case "stats":
+		os.Exit(runStats(os.Args[2:]))
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
 	}
-	defer fp.Close()
-	dict := migemo.BuildDictionaryFromMigemoDictFile(fp)
+}
+
+func demo() {
+	dict := defaultdict.Default()
 	fmt.Printf("IoSize: %d\n", dict.IoSize())
 	a, b := dict.NodeSize()
 	fmt.Printf("#Nodes: %d %d\n", a, b)
 	operator := migemo.NewRegexOperator("|", "(", ")", "[", "]", "")
 	fmt.Printf(migemo.Query("kensaku", dict, operator))
 }
+
+// loadDictionary は、pathの辞書を読み込む。pathが空なら埋め込みの辞書を返す
+func loadDictionary(path string) (*migemo.CompactDictionary, error) {
+	if path == "" {
+		return defaultdict.Default(), nil
+	}
+	buffer, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return migemo.NewCompactDictionary(buffer)
+}
+
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	dictPath := flags.String("dict", "", "dictionary file")
+	flags.Parse(args)
+	dict, err := loadDictionary(*dictPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	err = dict.Verify()
+	var verifyError *migemo.VerifyError
+	if errors.As(err, &verifyError) {
+		for _, issue := range verifyError.Issues {
+			fmt.Println(issue)
+		}
+		fmt.Fprintf(os.Stderr, "%d issues found\n", len(verifyError.Issues))
+		return 1
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("OK")
+	return 0
+}
+
+func runStats(args []string) int {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	dictPath := flags.String("dict", "", "dictionary file")
+	asJSON := flags.Bool("json", false, "print statistics as JSON")
+	flags.Parse(args)
+	dict, err := loadDictionary(*dictPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	stats := dict.Stats()
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(stats)
+	} else {
+		err = stats.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
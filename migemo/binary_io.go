@@ -0,0 +1,180 @@
+package migemo
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrUnexpectedEnd は、バイナリデータが途中で終わっていることを示す
+var ErrUnexpectedEnd = errors.New("migemo: unexpected end of binary data")
+
+// ErrCorruptBinary は、MarshalBinaryで書き出したデータとして正しくないことを示す
+var ErrCorruptBinary = errors.New("migemo: corrupt binary data")
+
+// binaryReader は、ビッグエンディアンのバイト配列を先頭から読み込む。
+// 読み込みに失敗すると以降の読み込みは全てゼロ値を返し、errに最初のエラーを保持する
+type binaryReader struct {
+	buffer []uint8
+	offset int
+	err    error
+}
+
+func newBinaryReader(buffer []uint8) *binaryReader {
+	return &binaryReader{
+		buffer: buffer,
+	}
+}
+
+func (reader *binaryReader) next(size int) []uint8 {
+	if reader.err != nil {
+		return nil
+	}
+	if size < 0 || len(reader.buffer)-reader.offset < size {
+		reader.err = ErrUnexpectedEnd
+		return nil
+	}
+	b := reader.buffer[reader.offset : reader.offset+size]
+	reader.offset += size
+	return b
+}
+
+func (reader *binaryReader) readUint8() uint8 {
+	b := reader.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (reader *binaryReader) readUint16() uint16 {
+	b := reader.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (reader *binaryReader) readUint32() uint32 {
+	b := reader.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (reader *binaryReader) readUint8Array() []uint8 {
+	size := int(reader.readUint32())
+	b := reader.next(size)
+	if b == nil {
+		return nil
+	}
+	array := make([]uint8, size)
+	copy(array, b)
+	return array
+}
+
+func (reader *binaryReader) readUint16Array() []uint16 {
+	size := int(reader.readUint32())
+	b := reader.next(size * 2)
+	if b == nil {
+		return nil
+	}
+	array := make([]uint16, size)
+	for i := 0; i < size; i++ {
+		array[i] = binary.BigEndian.Uint16(b[i*2:])
+	}
+	return array
+}
+
+func (reader *binaryReader) readInt16Array() []int16 {
+	array := reader.readUint16Array()
+	if array == nil {
+		return nil
+	}
+	result := make([]int16, len(array))
+	for i, x := range array {
+		result[i] = int16(x)
+	}
+	return result
+}
+
+func (reader *binaryReader) readUint32Array() []uint32 {
+	size := int(reader.readUint32())
+	b := reader.next(size * 4)
+	if b == nil {
+		return nil
+	}
+	array := make([]uint32, size)
+	for i := 0; i < size; i++ {
+		array[i] = binary.BigEndian.Uint32(b[i*4:])
+	}
+	return array
+}
+
+func (reader *binaryReader) readBitVector() *BitVector {
+	sizeInBits := reader.readUint32()
+	b := reader.next(int((sizeInBits+63)/64) * 8)
+	if b == nil {
+		return nil
+	}
+	words := make([]uint64, (sizeInBits+63)/64)
+	for i := 0; i < len(words); i++ {
+		words[i] = binary.BigEndian.Uint64(b[i*8:])
+	}
+	return NewBitVector(words, sizeInBits)
+}
+
+// binaryWriter は、ビッグエンディアンでバイト配列に書き込む
+type binaryWriter struct {
+	buffer []uint8
+}
+
+func (writer *binaryWriter) writeUint8(x uint8) {
+	writer.buffer = append(writer.buffer, x)
+}
+
+func (writer *binaryWriter) writeUint16(x uint16) {
+	writer.buffer = append(writer.buffer, uint8(x>>8), uint8(x))
+}
+
+func (writer *binaryWriter) writeUint32(x uint32) {
+	writer.buffer = append(writer.buffer, uint8(x>>24), uint8(x>>16), uint8(x>>8), uint8(x))
+}
+
+func (writer *binaryWriter) writeUint64(x uint64) {
+	writer.writeUint32(uint32(x >> 32))
+	writer.writeUint32(uint32(x))
+}
+
+func (writer *binaryWriter) writeUint8Array(array []uint8) {
+	writer.writeUint32(uint32(len(array)))
+	writer.buffer = append(writer.buffer, array...)
+}
+
+func (writer *binaryWriter) writeUint16Array(array []uint16) {
+	writer.writeUint32(uint32(len(array)))
+	for _, x := range array {
+		writer.writeUint16(x)
+	}
+}
+
+func (writer *binaryWriter) writeInt16Array(array []int16) {
+	writer.writeUint32(uint32(len(array)))
+	for _, x := range array {
+		writer.writeUint16(uint16(x))
+	}
+}
+
+func (writer *binaryWriter) writeUint32Array(array []uint32) {
+	writer.writeUint32(uint32(len(array)))
+	for _, x := range array {
+		writer.writeUint32(x)
+	}
+}
+
+func (writer *binaryWriter) writeBitVector(bitVector *BitVector) {
+	writer.writeUint32(bitVector.sizeInBits)
+	for _, w := range bitVector.words {
+		writer.writeUint64(w)
+	}
+}
@@ -0,0 +1,322 @@
+package migemo
+
+import (
+	"encoding"
+	"fmt"
+	"hash/crc32"
+	"math"
+)
+
+// 各構造のバイナリ形式は、4バイトのマジックナンバー、4バイトのペイロードの長さ、ペイロードのCRC32に続けて、
+// 辞書ファイルと同じビッグエンディアンで構造を格納する。トライのラベルは、UTF-16の2バイトで格納する
+const (
+	bitVectorMagic         = "MGBV"
+	loudsTrieMagic         = "MGLT"
+	loudsTrieU8Magic       = "MGL8"
+	loudsDoubleTrieMagic   = "MGLD"
+	loudsPrefixTrieMagic   = "MGLP"
+	loudsPatriciaTrieMagic = "MGPT"
+	tailMagic              = "MGTL"
+	doubleArrayMagic       = "MGDA"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*BitVector)(nil)
+	_ encoding.BinaryUnmarshaler = (*BitVector)(nil)
+	_ encoding.BinaryMarshaler   = (*LoudsTrieU16)(nil)
+	_ encoding.BinaryUnmarshaler = (*LoudsTrieU16)(nil)
+	_ encoding.BinaryMarshaler   = (*LoudsTrieU8)(nil)
+	_ encoding.BinaryUnmarshaler = (*LoudsTrieU8)(nil)
+	_ encoding.BinaryMarshaler   = (*LoudsDoubleTrie)(nil)
+	_ encoding.BinaryUnmarshaler = (*LoudsDoubleTrie)(nil)
+	_ encoding.BinaryMarshaler   = (*LoudsPrefixTrie)(nil)
+	_ encoding.BinaryUnmarshaler = (*LoudsPrefixTrie)(nil)
+	_ encoding.BinaryMarshaler   = (*LoudsPatriciaTrie)(nil)
+	_ encoding.BinaryUnmarshaler = (*LoudsPatriciaTrie)(nil)
+	_ encoding.BinaryMarshaler   = (*Tail)(nil)
+	_ encoding.BinaryUnmarshaler = (*Tail)(nil)
+	_ encoding.BinaryMarshaler   = (*DoubleArray)(nil)
+	_ encoding.BinaryUnmarshaler = (*DoubleArray)(nil)
+)
+
+// binaryFrameSize は、マジックナンバー、ペイロードの長さ、CRC32を合わせたバイト数
+const binaryFrameSize = 12
+
+func marshalBinary(magic string, write func(writer *binaryWriter)) []uint8 {
+	writer := &binaryWriter{}
+	writer.buffer = append(writer.buffer, magic...)
+	writer.writeUint32(0)
+	writer.writeUint32(0)
+	write(writer)
+	payload := writer.buffer[binaryFrameSize:]
+	frame := &binaryWriter{buffer: writer.buffer[len(magic):len(magic)]}
+	frame.writeUint32(uint32(len(payload)))
+	frame.writeUint32(crc32.ChecksumIEEE(payload))
+	return writer.buffer
+}
+
+// unmarshalBinary は、マジックナンバーとCRC32を確かめてからreadで構造を読み込み、verifyで整合性を検査する。
+// verifyが不整合を報告した場合はErrCorruptBinaryを返す
+func unmarshalBinary(data []uint8, magic string, read func(reader *binaryReader), verify func(v *verifier) bool) error {
+	reader := newBinaryReader(data)
+	if m := reader.next(len(magic)); m == nil || string(m) != magic {
+		return fmt.Errorf("%w: expected magic number %q", ErrCorruptBinary, magic)
+	}
+	size := reader.readUint32()
+	crc := reader.readUint32()
+	if reader.err != nil {
+		return reader.err
+	}
+	if uint32(len(data)-binaryFrameSize) < size {
+		return fmt.Errorf("%w: payload is %d bytes, got %d", ErrUnexpectedEnd, size, len(data)-binaryFrameSize)
+	}
+	if uint32(len(data)-binaryFrameSize) > size {
+		return fmt.Errorf("%w: %d trailing bytes", ErrCorruptBinary, uint32(len(data)-binaryFrameSize)-size)
+	}
+	if actual := crc32.ChecksumIEEE(data[binaryFrameSize:]); actual != crc {
+		return fmt.Errorf("%w: expected CRC32 %08x, got %08x", ErrCorruptBinary, crc, actual)
+	}
+	read(reader)
+	if reader.err != nil {
+		return fmt.Errorf("%w at offset %d", reader.err, reader.offset)
+	}
+	if reader.offset != len(data) {
+		return fmt.Errorf("%w: %d trailing bytes", ErrCorruptBinary, len(data)-reader.offset)
+	}
+	v := &verifier{}
+	if !v.run(magic, func() bool { return verify(v) }) {
+		return fmt.Errorf("%w: %s", ErrCorruptBinary, v.issues[0])
+	}
+	return nil
+}
+
+// MarshalBinary は、BitVectorをバイナリ形式で書き出す
+func (bitVector *BitVector) MarshalBinary() ([]uint8, error) {
+	return marshalBinary(bitVectorMagic, func(writer *binaryWriter) {
+		writer.writeBitVector(bitVector)
+	}), nil
+}
+
+// UnmarshalBinary は、MarshalBinaryで書き出したBitVectorを読み込む
+func (bitVector *BitVector) UnmarshalBinary(data []uint8) error {
+	var loaded *BitVector
+	err := unmarshalBinary(data, bitVectorMagic, func(reader *binaryReader) {
+		loaded = reader.readBitVector()
+	}, func(v *verifier) bool {
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	*bitVector = *loaded
+	return nil
+}
+
+// MarshalBinary は、LoudsTrieU16をバイナリ形式で書き出す
+func (trie *LoudsTrieU16) MarshalBinary() ([]uint8, error) {
+	return marshalBinary(loudsTrieMagic, func(writer *binaryWriter) {
+		writeLoudsTrie(writer, trie, KeyEncodingUTF16)
+	}), nil
+}
+
+// UnmarshalBinary は、MarshalBinaryで書き出したLoudsTrieU16を読み込む
+func (trie *LoudsTrieU16) UnmarshalBinary(data []uint8) error {
+	var loaded *LoudsTrieU16
+	err := unmarshalBinary(data, loudsTrieMagic, func(reader *binaryReader) {
+		loaded = readLoudsTrie(reader, KeyEncodingUTF16)
+	}, func(v *verifier) bool {
+		return v.verifyLoudsTrie("trie", loaded)
+	})
+	if err != nil {
+		return err
+	}
+	*trie = *loaded
+	return nil
+}
+
+// MarshalBinary は、LoudsTrieU8をバイナリ形式で書き出す
+func (trie *LoudsTrieU8) MarshalBinary() ([]uint8, error) {
+	return marshalBinary(loudsTrieU8Magic, func(writer *binaryWriter) {
+		writeLoudsTrieU8(writer, trie)
+	}), nil
+}
+
+// UnmarshalBinary は、MarshalBinaryで書き出したLoudsTrieU8を読み込む
+func (trie *LoudsTrieU8) UnmarshalBinary(data []uint8) error {
+	var loaded *LoudsTrieU8
+	err := unmarshalBinary(data, loudsTrieU8Magic, func(reader *binaryReader) {
+		edges := reader.readUint8Array()
+		loaded = NewLoudsTrieU8(reader.readBitVector(), edges)
+	}, func(v *verifier) bool {
+		return v.verifyLoudsShape("trie.bitVector", loaded.bitVector, len(loaded.edges)-1)
+	})
+	if err != nil {
+		return err
+	}
+	*trie = *loaded
+	return nil
+}
+
+// MarshalBinary は、LoudsDoubleTrieをバイナリ形式で書き出す
+func (trie *LoudsDoubleTrie) MarshalBinary() ([]uint8, error) {
+	return marshalBinary(loudsDoubleTrieMagic, func(writer *binaryWriter) {
+		writeLoudsDoubleTrie(writer, trie, KeyEncodingUTF16)
+	}), nil
+}
+
+// UnmarshalBinary は、MarshalBinaryで書き出したLoudsDoubleTrieを読み込む
+func (trie *LoudsDoubleTrie) UnmarshalBinary(data []uint8) error {
+	var loaded *LoudsDoubleTrie
+	err := unmarshalBinary(data, loudsDoubleTrieMagic, func(reader *binaryReader) {
+		loaded = readLoudsDoubleTrie(reader, KeyEncodingUTF16)
+	}, func(v *verifier) bool {
+		return v.verifyLoudsDoubleTrie("trie", loaded)
+	})
+	if err != nil {
+		return err
+	}
+	*trie = *loaded
+	return nil
+}
+
+// MarshalBinary は、LoudsPrefixTrieをバイナリ形式で書き出す
+func (trie *LoudsPrefixTrie) MarshalBinary() ([]uint8, error) {
+	return marshalBinary(loudsPrefixTrieMagic, func(writer *binaryWriter) {
+		writeTrie(writer, trie, KeyEncodingUTF16)
+	}), nil
+}
+
+// UnmarshalBinary は、MarshalBinaryで書き出したLoudsPrefixTrieを読み込む
+func (trie *LoudsPrefixTrie) UnmarshalBinary(data []uint8) error {
+	var loaded *LoudsPrefixTrie
+	err := unmarshalBinary(data, loudsPrefixTrieMagic, func(reader *binaryReader) {
+		loaded, _ = readTrie(reader, TrieTypePrefix, KeyEncodingUTF16).(*LoudsPrefixTrie)
+	}, func(v *verifier) bool {
+		return v.verifyLoudsTailTrie("trie", loaded.trie, loaded.outs, loaded.links, loaded.tail)
+	})
+	if err != nil {
+		return err
+	}
+	*trie = *loaded
+	return nil
+}
+
+// MarshalBinary は、LoudsPatriciaTrieをバイナリ形式で書き出す
+func (trie *LoudsPatriciaTrie) MarshalBinary() ([]uint8, error) {
+	return marshalBinary(loudsPatriciaTrieMagic, func(writer *binaryWriter) {
+		writeTrie(writer, trie, KeyEncodingUTF16)
+	}), nil
+}
+
+// UnmarshalBinary は、MarshalBinaryで書き出したLoudsPatriciaTrieを読み込む
+func (trie *LoudsPatriciaTrie) UnmarshalBinary(data []uint8) error {
+	var loaded *LoudsPatriciaTrie
+	err := unmarshalBinary(data, loudsPatriciaTrieMagic, func(reader *binaryReader) {
+		loaded, _ = readTrie(reader, TrieTypePatricia, KeyEncodingUTF16).(*LoudsPatriciaTrie)
+	}, func(v *verifier) bool {
+		return v.verifyLoudsTailTrie("trie", loaded.trie, loaded.outs, loaded.links, loaded.tail)
+	})
+	if err != nil {
+		return err
+	}
+	*trie = *loaded
+	return nil
+}
+
+// MarshalBinary は、Tailをバイナリ形式で書き出す
+func (tail *Tail) MarshalBinary() ([]uint8, error) {
+	return marshalBinary(tailMagic, func(writer *binaryWriter) {
+		writeTail(writer, tail, KeyEncodingUTF16)
+	}), nil
+}
+
+// UnmarshalBinary は、MarshalBinaryで書き出したTailを読み込む
+func (tail *Tail) UnmarshalBinary(data []uint8) error {
+	var loaded *Tail
+	err := unmarshalBinary(data, tailMagic, func(reader *binaryReader) {
+		loaded = readTail(reader, KeyEncodingUTF16)
+	}, func(v *verifier) bool {
+		return v.verifyTail("tail", loaded)
+	})
+	if err != nil {
+		return err
+	}
+	*tail = *loaded
+	return nil
+}
+
+// MarshalBinary は、DoubleArrayをバイナリ形式で書き出す。文字の変換関数は書き出さない
+func (doubleArray *DoubleArray) MarshalBinary() ([]uint8, error) {
+	return marshalBinary(doubleArrayMagic, func(writer *binaryWriter) {
+		writer.writeUint32(uint32(doubleArray.charSize))
+		writer.writeInt16Array(doubleArray.base)
+		writer.writeInt16Array(doubleArray.check)
+	}), nil
+}
+
+// UnmarshalBinary は、MarshalBinaryで書き出したDoubleArrayを読み込む。
+// 文字の変換関数は、doubleArrayが既に持っていればそれを使い、なければバイトをそのまま文字コードとする
+func (doubleArray *DoubleArray) UnmarshalBinary(data []uint8) error {
+	var charSize int
+	var base, check []int16
+	err := unmarshalBinary(data, doubleArrayMagic, func(reader *binaryReader) {
+		charSize = int(reader.readUint32())
+		base = reader.readInt16Array()
+		check = reader.readInt16Array()
+	}, func(v *verifier) bool {
+		return v.verifyDoubleArray("doubleArray", base, check, charSize)
+	})
+	if err != nil {
+		return err
+	}
+	charConverter := doubleArray.charConverter
+	if charConverter == nil {
+		charConverter = func(c uint8) int {
+			return int(c)
+		}
+	}
+	*doubleArray = *NewDoubleArray(base, check, charConverter, charSize)
+	return nil
+}
+
+// verifyDoubleArray は、baseとcheckの値が配列の範囲内にあり、checkで親をたどると根に着くかを検査する
+func (v *verifier) verifyDoubleArray(name string, base []int16, check []int16, charSize int) bool {
+	if charSize < 1 || charSize > 256 {
+		v.report(name, 0, "invalid character size %d", charSize)
+		return false
+	}
+	if len(base) == 0 || len(base) > math.MaxInt16 || len(base) != len(check) {
+		v.report(name+".check", len(check), "has %d entries, but base has %d entries", len(check), len(base))
+		return false
+	}
+	for i := range base {
+		if base[i] < -1 || int(base[i]) >= len(base) {
+			v.report(name+".base", i, "value %d is out of range [-1, %d)", base[i], len(base))
+			return false
+		}
+		if check[i] < -1 || int(check[i]) >= len(check) || (i == 0 && check[i] != -1) {
+			v.report(name+".check", i, "value %d is out of range [-1, %d)", check[i], len(check))
+			return false
+		}
+	}
+	// depths[i]は、ノードiの根からの深さ+1。0は未確定、-1は探索中
+	depths := make([]int, len(check))
+	depths[0] = 1
+	for i := range check {
+		path := []int{}
+		n := i
+		for check[n] >= 0 && depths[n] == 0 {
+			depths[n] = -1
+			path = append(path, n)
+			n = int(check[n])
+		}
+		if depths[n] < 0 {
+			v.report(name+".check", i, "node %d is on a cycle", n)
+			return false
+		}
+		for j := len(path) - 1; j >= 0; j-- {
+			depths[path[j]] = depths[n] + len(path) - j
+		}
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+package migemo_test
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func TestBitVector_MarshalBinary(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	bits := make([]bool, 1000)
+	for i := range bits {
+		bits[i] = random.Intn(3) == 0
+	}
+	bitVector := migemo.NewBitVector(bits_to_vector(bits), uint32(len(bits)))
+	data, err := bitVector.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &migemo.BitVector{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Size() != len(bits) {
+		t.Fatalf("expected:%d actual:%d", len(bits), loaded.Size())
+	}
+	for i := range bits {
+		if loaded.Get(uint32(i)) != bits[i] || loaded.Rank(uint(i), true) != bitVector.Rank(uint(i), true) {
+			t.Fatalf("bit %d differs", i)
+		}
+	}
+}
+
+func TestTrie_MarshalBinary(t *testing.T) {
+	words := []string{"かい", "かいしゃ", "かいじ", "かんじ", "きょう", "けんさく", "けんさくする", "とうきょう", "とうきょうと", "ぶんしょう"}
+	sort.Strings(words)
+	keys := make([][]uint16, len(words))
+	for i, w := range words {
+		keys[i] = utf16.Encode([]rune(w))
+	}
+	for _, trieType := range []migemo.TrieType{migemo.TrieTypeLouds, migemo.TrieTypeDouble, migemo.TrieTypePrefix, migemo.TrieTypePatricia} {
+		trie, _ := migemo.BuildTrie(trieType, keys)
+		data, err := trie.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var loaded migemo.Trie
+		switch trieType {
+		case migemo.TrieTypeLouds:
+			loaded = &migemo.LoudsTrieU16{}
+		case migemo.TrieTypeDouble:
+			loaded = &migemo.LoudsDoubleTrie{}
+		case migemo.TrieTypePrefix:
+			loaded = &migemo.LoudsPrefixTrie{}
+		case migemo.TrieTypePatricia:
+			loaded = &migemo.LoudsPatriciaTrie{}
+		}
+		if err := loaded.(encoding.BinaryUnmarshaler).UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", trieType, err)
+		}
+		for _, key := range keys {
+			if expected, actual := trie.Lookup(key), loaded.Lookup(key); expected != actual {
+				t.Errorf("%s %s: expected:%d actual:%d", trieType, string(utf16.Decode(key)), expected, actual)
+			}
+		}
+		if err := loaded.(encoding.BinaryUnmarshaler).UnmarshalBinary(data[:len(data)-1]); !errors.Is(err, migemo.ErrUnexpectedEnd) {
+			t.Errorf("%s: truncated data must fail with ErrUnexpectedEnd: %v", trieType, err)
+		}
+		if err := loaded.(encoding.BinaryUnmarshaler).UnmarshalBinary(append(data, 0)); !errors.Is(err, migemo.ErrCorruptBinary) {
+			t.Errorf("%s: trailing data must fail with ErrCorruptBinary: %v", trieType, err)
+		}
+		for i := range data {
+			corrupted := append([]uint8{}, data...)
+			corrupted[i] ^= 0x10
+			if err := loaded.(encoding.BinaryUnmarshaler).UnmarshalBinary(corrupted); err == nil {
+				t.Errorf("%s: corrupted byte %d must be detected", trieType, i)
+			}
+		}
+	}
+	prefix, _ := migemo.BuildLoudsPrefixTrie(keys)
+	data, _ := prefix.MarshalBinary()
+	if err := (&migemo.LoudsPatriciaTrie{}).UnmarshalBinary(data); !errors.Is(err, migemo.ErrCorruptBinary) {
+		t.Errorf("magic number must be checked: %v", err)
+	}
+}
+
+func TestTrie_MarshalBinary_Small(t *testing.T) {
+	for _, words := range [][]string{{}, {"a"}, {"a", "ab"}, {"abc", "abd"}} {
+		keys := make([][]uint16, len(words))
+		for i, w := range words {
+			keys[i] = utf16.Encode([]rune(w))
+		}
+		for _, trieType := range []migemo.TrieType{migemo.TrieTypeLouds, migemo.TrieTypeDouble, migemo.TrieTypePrefix, migemo.TrieTypePatricia} {
+			trie, _ := migemo.BuildTrie(trieType, keys)
+			data, err := trie.(encoding.BinaryMarshaler).MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded migemo.Trie
+			switch trieType {
+			case migemo.TrieTypeLouds:
+				loaded = &migemo.LoudsTrieU16{}
+			case migemo.TrieTypeDouble:
+				loaded = &migemo.LoudsDoubleTrie{}
+			case migemo.TrieTypePrefix:
+				loaded = &migemo.LoudsPrefixTrie{}
+			case migemo.TrieTypePatricia:
+				loaded = &migemo.LoudsPatriciaTrie{}
+			}
+			if err := loaded.(encoding.BinaryUnmarshaler).UnmarshalBinary(data); err != nil {
+				t.Errorf("%s %v: %v", trieType, words, err)
+				continue
+			}
+			for _, key := range append(keys, utf16.Encode([]rune("ab")), utf16.Encode([]rune("b"))) {
+				if expected, actual := trie.Lookup(key), loaded.Lookup(key); expected != actual {
+					t.Errorf("%s %v %s: expected:%d actual:%d", trieType, words, string(utf16.Decode(key)), expected, actual)
+				}
+			}
+		}
+		u8, _ := migemo.BuildLoudsTrieU8(words)
+		data, _ := u8.MarshalBinary()
+		if err := (&migemo.LoudsTrieU8{}).UnmarshalBinary(data); err != nil {
+			t.Errorf("u8 %v: %v", words, err)
+		}
+	}
+}
+
+func TestLoudsTrieU8_MarshalBinary(t *testing.T) {
+	words := []string{"かな", "かなさんどう", "とうきょう", "東京"}
+	trie, _ := migemo.BuildLoudsTrieU8(words)
+	data, err := trie.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &migemo.LoudsTrieU8{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range words {
+		if expected, actual := trie.Lookup([]uint8(word)), loaded.Lookup([]uint8(word)); expected != actual || actual < 0 {
+			t.Errorf("%s: expected:%d actual:%d", word, expected, actual)
+		}
+	}
+}
+
+func TestTail_MarshalBinary(t *testing.T) {
+	words := []string{"dance", "ce", "nce", "", "ance", "x", "とうきょう", "きょう"}
+	tail := buildTail(words...)
+	data, err := tail.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &migemo.Tail{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range words {
+		if actual := string(utf16.Decode(loaded.Get(i))); actual != w {
+			t.Errorf("index:%d expected:%q actual:%q", i, w, actual)
+		}
+	}
+}
+
+func TestDoubleArray_MarshalBinary(t *testing.T) {
+	keys := []string{"a", "ab", "abc", "b", "bcd"}
+	doubleArray := migemo.BuildDoubleArray(keys)
+	data, err := doubleArray.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &migemo.DoubleArray{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range append(keys, "c", "abd") {
+		if expected, actual := doubleArray.Lookup(key), loaded.Lookup(key); expected != actual {
+			t.Errorf("%s: expected:%d actual:%d", key, expected, actual)
+		}
+	}
+}
+
+// updateBinaryChecksum は、書き換えたバイナリ形式のペイロードに合わせてCRC32を直す
+func updateBinaryChecksum(data []uint8) {
+	binary.BigEndian.PutUint32(data[8:12], crc32.ChecksumIEEE(data[12:]))
+}
+
+func TestLoudsTrieU16_UnmarshalBinary_Shape(t *testing.T) {
+	trie, _ := migemo.BuildLoudsTrie([][]uint16{utf16.Encode([]rune("か")), utf16.Encode([]rune("き"))})
+	data, _ := trie.MarshalBinary()
+	// ノード3の親をノード3自身にする
+	bad := migemo.NewBitVector(bits_to_vector([]bool{true, false, true, false, false, true, false, false}), 8)
+	badData, _ := bad.MarshalBinary()
+	data = append(data[:len(data)-len(badData)+12], badData[12:]...)
+	updateBinaryChecksum(data)
+	if err := (&migemo.LoudsTrieU16{}).UnmarshalBinary(data); !errors.Is(err, migemo.ErrCorruptBinary) {
+		t.Errorf("invalid LOUDS must fail with ErrCorruptBinary: %v", err)
+	}
+}
+
+func TestDoubleArray_UnmarshalBinary_Range(t *testing.T) {
+	doubleArray := migemo.BuildDoubleArray([]string{"a", "ab", "abc", "b", "bcd"})
+	data, _ := doubleArray.MarshalBinary()
+	n := int(binary.BigEndian.Uint32(data[16:20]))
+	// ペイロードは、文字の種類数、baseの長さ、base、checkの長さ、checkの順
+	base, check := 20, 24+2*n
+	for _, c := range []struct {
+		name   string
+		offset int
+		value  int16
+	}{
+		{"base too large", base, 0x7fff},
+		{"base too small", base + 2, -2},
+		{"check out of range", check + 2, int16(n)},
+		{"check of root", check, 0},
+		{"cycle", check + 2, 1},
+	} {
+		corrupted := append([]uint8{}, data...)
+		binary.BigEndian.PutUint16(corrupted[c.offset:], uint16(c.value))
+		updateBinaryChecksum(corrupted)
+		if err := (&migemo.DoubleArray{}).UnmarshalBinary(corrupted); !errors.Is(err, migemo.ErrCorruptBinary) {
+			t.Errorf("%s: expected ErrCorruptBinary, actual:%v", c.name, err)
+		}
+	}
+}
@@ -5,12 +5,18 @@ import (
 	"math/bits"
 )
 
+// selectSampleRate は、Selectの索引で位置を記録する間隔(ビットの個数)
+const selectSampleRate = 256
+
 // BitVector は、RankやSelectの計算が高速なビット配列
 type BitVector struct {
 	words      []uint64
 	sizeInBits uint32
 	lb         []uint32
 	sb         []uint16
+	// select0Hints[k]とselect1Hints[k]は、k*selectSampleRate+1番目の0と1を含むlbのブロックの番号
+	select0Hints []uint32
+	select1Hints []uint32
 }
 
 // NewBitVector は、BitVectorを初期化する
@@ -35,12 +41,49 @@ func NewBitVector(words []uint64, sizeInBits uint32) *BitVector {
 			sumInLb = 0
 		}
 	}
-	return &BitVector{
-		words,
-		sizeInBits,
-		lb,
-		sb,
+	return newBitVectorWithIndex(words, sizeInBits, lb, sb)
+}
+
+// newBitVectorWithIndex は、Rankの索引(lb,sb)を作成済みのビット配列から、Selectの索引を作成してBitVectorを初期化する
+func newBitVectorWithIndex(words []uint64, sizeInBits uint32, lb []uint32, sb []uint16) *BitVector {
+	bitVector := &BitVector{
+		words:      words,
+		sizeInBits: sizeInBits,
+		lb:         lb,
+		sb:         sb,
+	}
+	if len(words) > 0 {
+		last := len(words) - 1
+		ones := lb[last>>3] + uint32(sb[last]) + uint32(bits.OnesCount64(words[last]))
+		if ones > sizeInBits {
+			// 壊れた索引から巨大な索引を作らないようにする
+			ones = sizeInBits
+		}
+		bitVector.select0Hints = bitVector.buildSelectHints(sizeInBits-ones, false)
+		bitVector.select1Hints = bitVector.buildSelectHints(ones, true)
+	}
+	return bitVector
+}
+
+// countBeforeLb は、lbのindex番目のブロックより前にあるb値の個数を返す
+func (bitVector *BitVector) countBeforeLb(index int, b bool) uint32 {
+	if b {
+		return bitVector.lb[index]
 	}
+	return uint32(index<<9) - bitVector.lb[index]
+}
+
+// buildSelectHints は、b値をselectSampleRate個毎に、それを含むlbのブロックの番号を記録する
+func (bitVector *BitVector) buildSelectHints(total uint32, b bool) []uint32 {
+	hints := make([]uint32, 0, total/selectSampleRate+1)
+	index := 0
+	for count := uint32(1); count <= total; count += selectSampleRate {
+		for index+1 < len(bitVector.lb) && bitVector.countBeforeLb(index+1, b) < count {
+			index++
+		}
+		hints = append(hints, uint32(index))
+	}
+	return hints
 }
 
 // Rank は、pos位置のb値が何個あるかを返す
@@ -60,7 +103,28 @@ func (bitVector *BitVector) Rank(pos uint, b bool) uint {
 
 // Select は、b値のcount番目の位置を返す
 func (bitVector *BitVector) Select(count uint32, b bool) uint {
-	var lbIndex uint32 = bitVector.lowerBoundBinarySearchLB(count, b) - 1
+	hints := bitVector.select1Hints
+	if !b {
+		hints = bitVector.select0Hints
+	}
+	// 索引で、count番目のb値を含むlbのブロックの範囲を絞り込む
+	low, high := -1, len(bitVector.lb)
+	if k := int(count-1) / selectSampleRate; count > 0 && k < len(hints) {
+		low = int(hints[k])
+		if k+1 < len(hints) {
+			high = int(hints[k+1]) + 1
+		}
+	}
+	return bitVector.selectInLb(count, b, bitVector.lowerBoundBinarySearchLB(count, b, low, high)-1)
+}
+
+// selectWithoutHints は、Selectの索引を使わずに、lb全体を二分探索してb値のcount番目の位置を返す
+func (bitVector *BitVector) selectWithoutHints(count uint32, b bool) uint {
+	return bitVector.selectInLb(count, b, bitVector.lowerBoundBinarySearchLB(count, b, -1, len(bitVector.lb))-1)
+}
+
+// selectInLb は、lbのlbIndex番目のブロックに含まれる、b値のcount番目の位置を返す
+func (bitVector *BitVector) selectInLb(count uint32, b bool, lbIndex uint32) uint {
 	var countInLb uint32
 	var countInSb uint32
 	if b {
@@ -107,7 +171,8 @@ func selectInWord(word uint64, count uint) uint {
 		count = count - lower4bitCount
 		i = i + 4
 	}
-	for count > 0 {
+	// 壊れた索引でcountが語の中のビット数を超えても、語の末尾で止める
+	for count > 0 && i < 64 {
 		count = count - uint(word&1)
 		word = word >> 1
 		i = i + 1
@@ -115,9 +180,8 @@ func selectInWord(word uint64, count uint) uint {
 	return i
 }
 
-func (bitVector *BitVector) lowerBoundBinarySearchLB(key uint32, b bool) uint32 {
-	var high = len(bitVector.lb)
-	var low = -1
+// lowerBoundBinarySearchLB は、lbの(low, high)の範囲で、前にあるb値の個数がkey以上になる最初のブロックの番号を返す
+func (bitVector *BitVector) lowerBoundBinarySearchLB(key uint32, b bool, low int, high int) uint32 {
 	if b {
 		for high-low > 1 {
 			var mid = int(high+low) >> 1
@@ -185,6 +249,26 @@ func (bitVector *BitVector) NextClearBit(fromIndex uint) uint {
 	return math.MaxUint32 // Unreachable here
 }
 
+// NextSetBit は、fromIndexから次の1ビットの位置を取得する
+func (bitVector *BitVector) NextSetBit(fromIndex uint) uint {
+	var u = int(fromIndex / 64)
+	if u >= len(bitVector.words) {
+		return fromIndex
+	}
+	var word uint64 = bitVector.words[u] & uint64(^uint64(0)<<(fromIndex&63))
+	for true {
+		if word != 0 {
+			return uint(u*64) + uint(bits.TrailingZeros64(word))
+		}
+		u = u + 1
+		if u == len(bitVector.words) {
+			return uint(len(bitVector.words)) * 64
+		}
+		word = bitVector.words[u]
+	}
+	return math.MaxUint32 // Unreachable here
+}
+
 // Size は、ビット配列の長さを返す
 func (bitVector *BitVector) Size() int {
 	return int(bitVector.sizeInBits)
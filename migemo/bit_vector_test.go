@@ -107,3 +107,55 @@ func TestNextClearBit(t *testing.T) {
 		t.Error()
 	}
 }
+
+func TestSelect_Density(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for _, density := range []int{1, 10, 50, 90, 99} {
+		size := 5000
+		bits := make([]bool, size)
+		for i := range bits {
+			bits[i] = random.Intn(100) < density
+		}
+		bv := migemo.NewBitVector(bits_to_vector(bits), uint32(size))
+		positions := map[bool][]int{}
+		for i, bit := range bits {
+			positions[bit] = append(positions[bit], i)
+		}
+		for _, b := range []bool{true, false} {
+			for i, expected := range positions[b] {
+				if actual := bv.Select(uint32(i+1), b); int(actual) != expected {
+					t.Fatalf("density:%d b:%t count:%d expected:%d actual:%d", density, b, i+1, expected, actual)
+				}
+			}
+		}
+	}
+}
+
+func benchmarkSelect(b *testing.B, selectFunc func(bv *migemo.BitVector, count uint32, b bool) uint) {
+	random := rand.New(rand.NewSource(1))
+	size := 1 << 20
+	bits := make([]bool, size)
+	for i := range bits {
+		bits[i] = random.Intn(2) == 1
+	}
+	bv := migemo.NewBitVector(bits_to_vector(bits), uint32(size))
+	ones := int(bv.Rank(uint(size-1), true))
+	counts := make([]uint32, 1024)
+	for i := range counts {
+		counts[i] = uint32(random.Intn(ones) + 1)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := counts[i%len(counts)]
+		selectFunc(bv, count, true)
+		selectFunc(bv, count, false)
+	}
+}
+
+func BenchmarkBitVector_Select(b *testing.B) {
+	benchmarkSelect(b, (*migemo.BitVector).Select)
+}
+
+func BenchmarkBitVector_SelectWithoutHints(b *testing.B) {
+	benchmarkSelect(b, (*migemo.BitVector).SelectWithoutHints)
+}
@@ -1,90 +1,34 @@
 package migemo
 
-import (
-	"encoding/binary"
-)
-
-// CompactDictionary は、読み毎に複数の単語を格納した辞書
+// CompactDictionary は、読み毎に複数の単語を格納した辞書。
+// 読みと単語は、同じ種類のTrieにそれぞれ格納する。
+// nilの*CompactDictionaryは、単語を一つも持たない辞書として検索できる
 type CompactDictionary struct {
-	keyTrie          *LoudsDoubleTrie
-	valueTrie        *LoudsDoubleTrie
+	keyTrie          Trie
+	valueTrie        Trie
 	mappingBitVector *BitVector
 	mapping          []uint32
 	// hasMappingBitList は、あるノードがマッピングを持つかを格納する
 	hasMappingBitList *BitList
+	// weights は、mappingと同じ順に並べた単語の重み。重みを持たない辞書ではnil
+	weights []uint8
 }
 
-// NewCompactDictionary は、バイト配列からCompactDictionaryを読み込む
-/*
-func NewCompactDictionary(buffer []uint8) *CompactDictionary {
-	var offset = 0
-	keyTrie, offset := readTrie(buffer, offset, true)
-	valueTrie, offset := readTrie(buffer, offset, false)
-	var mappingBitVectorSize = binary.BigEndian.Uint32(buffer[offset:])
-	offset = offset + 4
-	var mappingBitVectorWords = make([]uint64, (mappingBitVectorSize+63)/64)
-	for i := 0; i < len(mappingBitVectorWords); i++ {
-		mappingBitVectorWords[i] = binary.BigEndian.Uint64(buffer[offset:])
-		offset = offset + 8
-	}
-	mappingBitVector := NewBitVector(mappingBitVectorWords, mappingBitVectorSize)
-	var mappingSize = binary.BigEndian.Uint32(buffer[offset:])
-	offset = offset + 4
-	mapping := make([]uint32, mappingSize)
-	for i := uint32(0); i < mappingSize; i++ {
-		mapping[i] = binary.BigEndian.Uint32(buffer[offset:])
-		offset += 4
-	}
-	if offset != len(buffer) {
-		return nil
-	}
-	hasMappingBitList := createHasMappingBitList(mappingBitVector)
-	return &CompactDictionary{
-		keyTrie,
-		valueTrie,
-		mappingBitVector,
-		mapping,
-		hasMappingBitList,
-	}
-}
-*/
-
 func createHasMappingBitList(mappingBitVector *BitVector) *BitList {
-	numOfNodes := mappingBitVector.Rank(uint(mappingBitVector.Size())+1, false)
-	bitList := NewBitListWithSize(int(numOfNodes))
-	bitPosition := uint(0)
-	for node := 1; node < int(numOfNodes); node++ {
-		var hasMapping = mappingBitVector.Get(uint32(bitPosition) + 1)
-		bitList.Set(node, hasMapping)
-		bitPosition = mappingBitVector.NextClearBit(bitPosition + 1)
+	// k番目の0ビットがノードkに対応し、直後のビットが1ならマッピングを持つ
+	bitList := NewBitList()
+	bitList.Add(false)
+	size := uint32(mappingBitVector.Size())
+	for pos := uint32(0); pos < size; pos++ {
+		if !mappingBitVector.Get(pos) {
+			bitList.Add(pos+1 < size && mappingBitVector.Get(pos+1))
+		}
 	}
 	return bitList
 }
 
-func readTrie(buffer []uint8, offset int, compactHiragana bool) (*LoudsTrieU16, int) {
-	var keyTrieEdgeSize = binary.BigEndian.Uint32(buffer[offset:])
-	offset = offset + 4
-	var keyTrieEdges = make([]uint16, keyTrieEdgeSize)
-	for i := uint32(0); i < keyTrieEdgeSize; i++ {
-		var c uint16
-		if compactHiragana {
-			c = decode(buffer[offset])
-			offset = offset + 1
-		} else {
-			c = binary.BigEndian.Uint16(buffer[offset:])
-			offset = offset + 2
-		}
-		keyTrieEdges[i] = c
-	}
-	var keyTrieBitVectorSize = binary.BigEndian.Uint32(buffer[offset:])
-	offset = offset + 4
-	var keyTrieBitVectorWords = make([]uint64, (keyTrieBitVectorSize+63)/64)
-	for i := 0; i < len(keyTrieBitVectorWords); i++ {
-		keyTrieBitVectorWords[i] = binary.BigEndian.Uint64(buffer[offset:])
-		offset = offset + 8
-	}
-	return NewLoudsTrie(NewBitVector(keyTrieBitVectorWords, keyTrieBitVectorSize), keyTrieEdges), offset
-}
+// compactEscape は、1バイトで表せない文字の前に置き、後続の2バイトがUTF-16であることを示す
+const compactEscape = 0xff
 
 func decode(c uint8) uint16 {
 	if 0x20 <= c && c <= 0x7e {
@@ -93,6 +37,9 @@ func decode(c uint8) uint16 {
 	if 0xa1 <= c && c <= 0xf6 {
 		return uint16(c) + 0x3040 - 0xa0
 	}
+	if 0xfc == c {
+		return 0x30fc
+	}
 	return 0
 }
 
@@ -104,15 +51,54 @@ func encode(c uint16) uint8 {
 		return uint8(c - 0x3040 + 0xa0)
 	}
 	if 0x30fc == c {
-		return uint8(c - 0x3040 + 0xa0)
+		return 0xfc
 	}
 	return 0
 }
 
+// encodeCompact は、文字列を1文字1バイトに符号化する。
+// 1バイトで表せない文字は、compactEscapeとUTF-16(ビッグエンディアン)の3バイトで表す
+func encodeCompact(s []uint16) []uint8 {
+	b := make([]uint8, 0, len(s))
+	for _, c := range s {
+		if e := encode(c); e != 0 {
+			b = append(b, e)
+		} else {
+			b = append(b, compactEscape, uint8(c>>8), uint8(c))
+		}
+	}
+	return b
+}
+
+// decodeCompact は、encodeCompactで符号化したバイト配列を復号する。不正なバイト列ならnil
+func decodeCompact(b []uint8, size int) []uint16 {
+	s := make([]uint16, 0, size)
+	for i := 0; i < len(b); i++ {
+		if b[i] == compactEscape {
+			if len(b) < i+3 {
+				return nil
+			}
+			s = append(s, uint16(b[i+1])<<8|uint16(b[i+2]))
+			i += 2
+		} else if c := decode(b[i]); c != 0 {
+			s = append(s, c)
+		} else {
+			return nil
+		}
+	}
+	if len(s) != size {
+		return nil
+	}
+	return s
+}
+
 // Search は、キーに一致する単語をコールバック関数fに返す
 func (compactDictionary *CompactDictionary) Search(key []uint16, f func([]uint16)) {
+	if compactDictionary == nil {
+		return
+	}
 	var keyIndex = compactDictionary.keyTrie.Lookup(key)
-	if keyIndex != -1 {
+	if keyIndex > 0 {
 		var valueStartPos = compactDictionary.mappingBitVector.Select(uint32(keyIndex), false)
 		var valueEndPos = compactDictionary.mappingBitVector.NextClearBit(valueStartPos + 1)
 		var size = uint(valueEndPos - valueStartPos - 1)
@@ -128,85 +114,179 @@ func (compactDictionary *CompactDictionary) Search(key []uint16, f func([]uint16
 	}
 }
 
+// CommonPrefixSearch は、keyの接頭辞になっている全ての読みについて、その読みの長さと単語を、読みの短い順にコールバック関数fに返す
+func (compactDictionary *CompactDictionary) CommonPrefixSearch(key []uint16, f func(keyLen int, word []uint16)) {
+	if compactDictionary == nil {
+		return
+	}
+	word := make([]uint16, 0, 16)
+	compactDictionary.keyTrie.CommonPrefixSearch(key, func(keyLen int, node int) {
+		if compactDictionary.hasMappingBitList.Get(node) {
+			compactDictionary.searchNode(node, &word, func(w []uint16) {
+				f(keyLen, w)
+			})
+		}
+	})
+}
+
 // PredictiveSearch は、接頭辞がkeyに一致する全ての単語をコールバック関数fに返す
 func (compactDictionary *CompactDictionary) PredictiveSearch(key []uint16, f func([]uint16)) {
-	var keyIndex = compactDictionary.keyTrie.Lookup(key)
+	var keyIndex = compactDictionary.lookupPrefix(key)
 	word := make([]uint16, 0, 16)
 	if keyIndex > 1 {
 		compactDictionary.keyTrie.PredictiveSearchBreadthFirst(keyIndex, func(i int) {
 			if compactDictionary.hasMappingBitList.Get(i) {
-				var valueStartPos uint = compactDictionary.mappingBitVector.Select(uint32(i), false)
-				var valueEndPos uint = compactDictionary.mappingBitVector.NextClearBit(valueStartPos + 1)
-				var size = valueEndPos - valueStartPos - 1
-				var offset = compactDictionary.mappingBitVector.Rank(valueStartPos, false)
-				for j := uint(0); j < size; j++ {
-					compactDictionary.valueTrie.ReverseLookup(compactDictionary.mapping[valueStartPos-offset+j], &word)
-					f(word)
-					word = word[:0]
-				}
+				compactDictionary.searchNode(i, &word, f)
 			}
 		})
 	}
 }
 
-// Save は、ファイルに辞書の内容を書き込む
-/*
-func (compactDictionary *CompactDictionary) Save(fp *os.File) {
-	writer := bufio.NewWriter(fp)
-	buffer := make([]byte, 8)
-	// output key trie
-	keyTriEdgesLength := uint32((len(compactDictionary.keyTrie.edges)))
-	binary.BigEndian.PutUint32(buffer, keyTriEdgesLength)
-	writer.Write(buffer[0:4])
-	for i := 0; i < len(compactDictionary.keyTrie.edges); i++ {
-		buffer[0] = encode(compactDictionary.keyTrie.edges[i])
-		writer.Write(buffer[:1])
-	}
-	binary.BigEndian.PutUint32(buffer, uint32(compactDictionary.keyTrie.bitVector.Size()))
-	writer.Write(buffer[0:4])
-	keyTrieBitVectorWords := compactDictionary.keyTrie.bitVector.words
-	for i := 0; i < len(keyTrieBitVectorWords); i++ {
-		binary.BigEndian.PutUint64(buffer, keyTrieBitVectorWords[i])
-		writer.Write(buffer)
-	}
-	// output value trie
-	valueTriEdgesLength := uint32((len(compactDictionary.valueTrie.edges)))
-	binary.BigEndian.PutUint32(buffer, valueTriEdgesLength)
-	writer.Write(buffer[:4])
-	for i := 0; i < len(compactDictionary.valueTrie.edges); i++ {
-		binary.BigEndian.PutUint16(buffer, compactDictionary.valueTrie.edges[i])
-		writer.Write(buffer[:2])
-	}
-	binary.BigEndian.PutUint32(buffer, uint32(compactDictionary.valueTrie.bitVector.Size()))
-	writer.Write(buffer[0:4])
-	valueTrieBitVectorWords := compactDictionary.valueTrie.bitVector.words
-	for i := 0; i < len(valueTrieBitVectorWords); i++ {
-		binary.BigEndian.PutUint64(buffer, valueTrieBitVectorWords[i])
-		writer.Write(buffer)
-	}
-
-	// output mapping trie
-	binary.BigEndian.PutUint32(buffer, uint32(compactDictionary.mappingBitVector.sizeInBits))
-	writer.Write(buffer[:4])
-	for _, w := range compactDictionary.mappingBitVector.words {
-		binary.BigEndian.PutUint64(buffer, w)
-		writer.Write(buffer)
-	}
-	binary.BigEndian.PutUint32(buffer, uint32(len(compactDictionary.mapping)))
-	writer.Write(buffer[:4])
-	for _, x := range compactDictionary.mapping {
-		binary.BigEndian.PutUint32(buffer, x)
-		writer.Write(buffer[:4])
-	}
-	writer.Flush()
-}
-*/
+// PredictiveSearchOrdered は、接頭辞がkeyに一致する単語を、読みとともに読みの辞書順にコールバック関数fに返す。同じ読みの単語は格納順に返す。
+// 先頭からoffset個の単語を読み飛ばし、limitが正ならlimit個まで返す。fがfalseを返したら打ち切る。
+// 打ち切ったか、limit個を超える単語が残っている場合はtrueを返す
+func (compactDictionary *CompactDictionary) PredictiveSearchOrdered(key []uint16, offset int, limit int, f func(key []uint16, word []uint16) bool) bool {
+	var keyIndex = compactDictionary.lookupPrefix(key)
+	if keyIndex <= 1 {
+		return false
+	}
+	found := make([]uint16, 0, 16)
+	word := make([]uint16, 0, 16)
+	skipped := 0
+	count := 0
+	return compactDictionary.keyTrie.PredictiveSearchOrdered(keyIndex, func(i int) bool {
+		if !compactDictionary.hasMappingBitList.Get(i) {
+			return true
+		}
+		start, end := compactDictionary.mappingRange(i)
+		// 読み飛ばす単語しか持たない読みは、キーを復元しない
+		if skip := uint(offset - skipped); offset > skipped && skip >= end-start {
+			skipped += int(end - start)
+			return true
+		}
+		found = found[:0]
+		compactDictionary.keyTrie.ReverseLookup(uint32(i), &found)
+		for j := start; j < end; j++ {
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			if limit > 0 && count == limit {
+				return false
+			}
+			count++
+			word = word[:0]
+			compactDictionary.valueTrie.ReverseLookup(compactDictionary.mapping[j], &word)
+			if !f(found, word) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// predictiveSearch は、接頭辞がkeyに一致する全ての単語を、その重みとともにコールバック関数fに返す。
+// withKeyが真なら、単語の読みも復元してfに渡す。maxNodesが正なら巡るキーのノード数をmaxNodesまでに制限する。
+// 巡ったノード数と、制限に達して検索を打ち切ったかを返す
+func (compactDictionary *CompactDictionary) predictiveSearch(key []uint16, withKey bool, maxNodes int, f func(key []uint16, word []uint16, weight uint8)) (int, bool) {
+	var keyIndex = compactDictionary.lookupPrefix(key)
+	if keyIndex <= 1 {
+		return 0, false
+	}
+	found := make([]uint16, 0, 16)
+	word := make([]uint16, 0, 16)
+	visited := 0
+	truncated := compactDictionary.keyTrie.predictiveSearchBreadthFirstUntil(keyIndex, func(i int) bool {
+		if maxNodes > 0 && visited >= maxNodes {
+			return false
+		}
+		visited++
+		if compactDictionary.hasMappingBitList.Get(i) {
+			if withKey {
+				found = found[:0]
+				compactDictionary.keyTrie.ReverseLookup(uint32(i), &found)
+			}
+			start, end := compactDictionary.mappingRange(i)
+			for j := start; j < end; j++ {
+				word = word[:0]
+				compactDictionary.valueTrie.ReverseLookup(compactDictionary.mapping[j], &word)
+				f(found, word, compactDictionary.weight(j))
+			}
+		}
+		return true
+	})
+	return visited, truncated
+}
+
+// PredictiveSearchBounded は、巡るキーのノード数をmaxNodesまでに制限して前方一致検索し、単語とその重みをコールバック関数fに返す。
+// 巡ったノード数と、制限に達して検索を打ち切ったかを返す
+func (compactDictionary *CompactDictionary) PredictiveSearchBounded(key []uint16, maxNodes int, f func(word []uint16, weight uint8)) (int, bool) {
+	return compactDictionary.predictiveSearch(key, false, maxNodes, func(key []uint16, word []uint16, weight uint8) {
+		f(word, weight)
+	})
+}
+
+// lookupPrefix は、接頭辞keyで前方一致検索を始めるノード番号を返す。見つからなければ-1。
+// keyがTAILの途中で終わる場合は、そのTAILを持つノードの子孫にkeyで始まる読みがあるので、そのノード番号を返す
+func (compactDictionary *CompactDictionary) lookupPrefix(key []uint16) int {
+	if compactDictionary == nil {
+		return -1
+	}
+	keyIndex := compactDictionary.keyTrie.Lookup(key)
+	if keyIndex < -1 {
+		return -keyIndex
+	}
+	return keyIndex
+}
+
+// mappingRange は、キーのノードnodeに対応する単語が格納されたmappingの範囲を返す
+func (compactDictionary *CompactDictionary) mappingRange(node int) (uint, uint) {
+	var valueStartPos uint = compactDictionary.mappingBitVector.Select(uint32(node), false)
+	var valueEndPos uint = compactDictionary.mappingBitVector.NextClearBit(valueStartPos + 1)
+	var offset = compactDictionary.mappingBitVector.Rank(valueStartPos, false)
+	return valueStartPos - offset, valueEndPos - offset - 1
+}
+
+// searchNode は、キーのノードnodeに対応する全ての単語を、格納順にコールバック関数fに返す。
+// wordは単語を復元するための作業領域
+func (compactDictionary *CompactDictionary) searchNode(node int, word *[]uint16, f func([]uint16)) {
+	start, end := compactDictionary.mappingRange(node)
+	for j := start; j < end; j++ {
+		*word = (*word)[:0]
+		compactDictionary.valueTrie.ReverseLookup(compactDictionary.mapping[j], word)
+		f(*word)
+	}
+}
+
+// HasWeights は、辞書が単語の重みを持つかを返す
+func (compactDictionary *CompactDictionary) HasWeights() bool {
+	return compactDictionary != nil && compactDictionary.weights != nil
+}
+
+// PredictiveSearchWeighted は、接頭辞がkeyに一致する全ての単語を、その重みとともにコールバック関数fに返す。
+// 重みを持たない辞書では、重みは全て0になる
+func (compactDictionary *CompactDictionary) PredictiveSearchWeighted(key []uint16, f func(word []uint16, weight uint8)) {
+	compactDictionary.PredictiveSearchBounded(key, 0, f)
+}
+
+// weight は、mappingのindex番目の単語の重みを返す
+func (compactDictionary *CompactDictionary) weight(index uint) uint8 {
+	if compactDictionary.weights == nil {
+		return 0
+	}
+	return compactDictionary.weights[index]
+}
 
 // IoSize is ...
 func (compactDictionary *CompactDictionary) IoSize() int {
 	return compactDictionary.keyTrie.IoSize() + compactDictionary.valueTrie.IoSize() + compactDictionary.mappingBitVector.IoSize() + IoSizeUint32Array(compactDictionary.mapping)
 }
 
+// TrieType は、読みと単語を格納したトライの種類を返す
+func (compactDictionary *CompactDictionary) TrieType() TrieType {
+	return trieTypeOf(compactDictionary.keyTrie)
+}
+
 // NodeSize is ...
 func (compactDictionary *CompactDictionary) NodeSize() (int, int) {
 	return compactDictionary.keyTrie.NumOfNodes(), compactDictionary.valueTrie.NumOfNodes()
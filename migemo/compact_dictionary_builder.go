@@ -2,58 +2,279 @@ package migemo
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"sort"
 	"strings"
 	"unicode/utf16"
 )
 
-// BuildDictionaryFromMigemoDictFile は、ファイルからCompactDictionaryを読み込む
-func BuildDictionaryFromMigemoDictFile(fp io.Reader) *CompactDictionary {
+// BuildWarningKind は、辞書の生成時に発生した警告の種類
+type BuildWarningKind int
+
+const (
+	// WarningSkippedKey は、キーが空のため、その行を読み飛ばしたことを示す
+	WarningSkippedKey BuildWarningKind = iota + 1
+	// WarningDuplicateKey は、既に出現したキーの行を、先の行に統合したことを示す
+	WarningDuplicateKey
+	// WarningEmptyValue は、空の単語を読み飛ばしたことを示す
+	WarningEmptyValue
+	// WarningMalformedLine は、形式が正しくない行を読み飛ばしたことを示す
+	WarningMalformedLine
+	// WarningUnsupportedCandidate は、展開できない候補を読み飛ばしたことを示す
+	WarningUnsupportedCandidate
+	// WarningInvalidWeight は、重みが範囲外のため、最大値に切り詰めたことを示す
+	WarningInvalidWeight
+	// WarningUndecodableSequence は、文字コードを変換できないバイト列をU+FFFDに置き換えたことを示す。
+	// BuildWarning.Keyには、そのバイト列を16進数で格納する
+	WarningUndecodableSequence
+)
+
+func (kind BuildWarningKind) String() string {
+	switch kind {
+	case WarningSkippedKey:
+		return "skipped key"
+	case WarningDuplicateKey:
+		return "duplicate key merged"
+	case WarningEmptyValue:
+		return "empty value"
+	case WarningMalformedLine:
+		return "malformed line"
+	case WarningUnsupportedCandidate:
+		return "unsupported candidate"
+	case WarningInvalidWeight:
+		return "weight out of range"
+	case WarningUndecodableSequence:
+		return "undecodable sequence"
+	}
+	return fmt.Sprintf("unknown(%d)", int(kind))
+}
+
+// BuildWarning は、辞書の生成時に発生した警告
+type BuildWarning struct {
+	// Line は、警告の発生した行番号(1始まり)
+	Line int
+	Kind BuildWarningKind
+	Key  string
+}
+
+func (warning BuildWarning) String() string {
+	return fmt.Sprintf("line %d: %s: %q", warning.Line, warning.Kind, warning.Key)
+}
+
+// ErrBuildWarning は、BuildOptions.Strictが有効なときに警告が発生したことを示す
+var ErrBuildWarning = errors.New("migemo: invalid dictionary entry")
+
+// BuildOptions は、辞書の生成方法を指定し、生成時の警告を受け取る
+type BuildOptions struct {
+	// Strict は、警告が発生したら辞書の生成をエラーで中断するかを指定する
+	Strict bool
+	// Warnings には、辞書の生成中に発生した警告が追加される
+	Warnings []BuildWarning
+	// Encoding は、入力の文字コードを指定する。EncodingAutoなら自動で判定する
+	Encoding Encoding
+	// Weighted は、単語を"単語;重み"の形式で書いて重みを指定できるようにする。
+	// 重みは0から255の整数で、省略した単語の重みは0とする
+	Weighted bool
+	// TrieType は、読みと単語を格納するトライの種類を指定する。0ならTrieTypeDoubleとする
+	TrieType TrieType
+}
+
+func (options *BuildOptions) trieType() TrieType {
+	if options == nil || options.TrieType == 0 {
+		return TrieTypeDouble
+	}
+	return options.TrieType
+}
+
+func (options *BuildOptions) weighted() bool {
+	return options != nil && options.Weighted
+}
+
+func (options *BuildOptions) encoding() Encoding {
+	if options == nil {
+		return EncodingAuto
+	}
+	return options.Encoding
+}
+
+func (options *BuildOptions) warn(line int, kind BuildWarningKind, key string) error {
+	warning := BuildWarning{
+		Line: line,
+		Kind: kind,
+		Key:  key,
+	}
+	if options == nil {
+		return nil
+	}
+	options.Warnings = append(options.Warnings, warning)
+	if options.Strict {
+		return fmt.Errorf("%w: %s", ErrBuildWarning, warning)
+	}
+	return nil
+}
+
+// readMigemoDict は、migemo-dict形式のファイルを読み込み、キーの一覧とキー毎の単語を返す。
+// 同じキーが複数回出現した場合は、後の行の単語を先の行の単語の後ろに追加する。
+// options.Weightedが有効なら、キー毎の単語の重みも返す
+func readMigemoDict(fp io.Reader, options *BuildOptions) ([]string, map[string][]string, map[string][]uint8, error) {
+	fp, err := newDecodingReader(fp, options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	scanner := bufio.NewScanner(fp)
 	dict := make(map[string][]string)
+	var weights map[string][]uint8
+	if options.weighted() {
+		weights = make(map[string][]uint8)
+	}
 	keys := make([]string, 0, 1024)
-	values := make(map[string]struct{}, 1024)
+	lineNumber := 0
 	for scanner.Scan() {
+		lineNumber++
 		line := scanner.Text()
 		if strings.HasPrefix(line, ";") || len(line) == 0 {
 			continue
 		}
 		columns := strings.Split(line, "\t")
 		key := columns[0]
-		var skip = false
-		for _, c := range utf16.Encode([]rune(key)) {
-			if encode(c) == 0 {
-				println("skip this word: ", key)
-				skip = true
-				break
+		if len(key) == 0 {
+			if err := options.warn(lineNumber, WarningSkippedKey, key); err != nil {
+				return nil, nil, nil, err
 			}
-		}
-		if skip {
 			continue
 		}
-		keys = append(keys, key)
+		words, duplicated := dict[key]
+		if duplicated {
+			if err := options.warn(lineNumber, WarningDuplicateKey, key); err != nil {
+				return nil, nil, nil, err
+			}
+		} else {
+			keys = append(keys, key)
+		}
+		if len(columns) == 1 {
+			if err := options.warn(lineNumber, WarningEmptyValue, key); err != nil {
+				return nil, nil, nil, err
+			}
+		}
 		for _, w := range columns[1:] {
+			var weight uint8
+			if weights != nil {
+				var ok bool
+				w, weight, ok = splitWeight(w)
+				if !ok {
+					if err := options.warn(lineNumber, WarningInvalidWeight, key); err != nil {
+						return nil, nil, nil, err
+					}
+				}
+			}
+			if len(w) == 0 {
+				if err := options.warn(lineNumber, WarningEmptyValue, key); err != nil {
+					return nil, nil, nil, err
+				}
+				continue
+			}
+			if duplicated {
+				if i := indexOfString(words, w); i >= 0 {
+					// 重複した単語は、大きい方の重みを採用する
+					if weights != nil && weights[key][i] < weight {
+						weights[key][i] = weight
+					}
+					continue
+				}
+			}
+			words = append(words, w)
+			if weights != nil {
+				weights[key] = append(weights[key], weight)
+			}
+		}
+		dict[key] = words
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("line %d: %w", lineNumber+1, err)
+	}
+	return keys, dict, weights, nil
+}
+
+// splitWeight は、"単語;重み"の形式の文字列を単語と重みに分ける。
+// 末尾が";数字"でなければ、文字列全体を重み0の単語とする。重みが255を超える場合は255に切り詰め、falseを返す
+func splitWeight(s string) (string, uint8, bool) {
+	i := strings.LastIndexByte(s, ';')
+	if i < 0 || i == len(s)-1 {
+		return s, 0, true
+	}
+	weight := 0
+	for _, c := range s[i+1:] {
+		if c < '0' || '9' < c {
+			return s, 0, true
+		}
+		if weight <= math.MaxUint8 {
+			weight = weight*10 + int(c-'0')
+		}
+	}
+	if weight > math.MaxUint8 {
+		return s[:i], math.MaxUint8, false
+	}
+	return s[:i], uint8(weight), true
+}
+
+func indexOfString(list []string, s string) int {
+	for i, e := range list {
+		if e == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsString(list []string, s string) bool {
+	return indexOfString(list, s) >= 0
+}
+
+// BuildDictionaryFromMigemoDictFile は、ファイルからCompactDictionaryを読み込む。
+// ファイルが圧縮されていれば展開する。文字コードはoptions.Encodingで指定し、省略すると自動で判定する。
+// optionsがnilでなければ、読み込み中に発生した警告をoptions.Warningsに追加する
+func BuildDictionaryFromMigemoDictFile(fp io.Reader, options *BuildOptions) (*CompactDictionary, error) {
+	keys, dict, weights, err := readMigemoDict(fp, options)
+	if err != nil {
+		return nil, err
+	}
+	return buildCompactDictionary(keys, dict, weights, options.trieType())
+}
+
+// buildCompactDictionary は、キーの一覧とキー毎の単語からCompactDictionaryを生成する。
+// weightsがnilでなければ、dictと同じ順に並べた単語の重みを格納する。読みと単語はtrieTypeの種類のトライに格納する
+func buildCompactDictionary(keys []string, dict map[string][]string, weights map[string][]uint8, trieType TrieType) (*CompactDictionary, error) {
+	values := make(map[string]struct{}, len(keys))
+	for _, words := range dict {
+		for _, w := range words {
 			values[w] = struct{}{}
 		}
-		dict[key] = columns[1:]
 	}
 
 	// build key trie
-	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
 	keysUtf16 := make([][]uint16, len(keys))
 	for i := 0; i < len(keys); i++ {
 		keysUtf16[i] = utf16.Encode([]rune(keys[i]))
 	}
-	keyTrie, _ := BuildLoudsDoubleTrie(keysUtf16)
+	sort.Slice(keysUtf16, func(i, j int) bool { return CompareUtf16String(keysUtf16[i], keysUtf16[j]) < 0 })
+	keyTrie, err := BuildTrie(trieType, keysUtf16)
+	if err != nil {
+		return nil, err
+	}
 
 	// build value trie
-	valuesUtf16 := make([][]uint16, 0, len(dict))
+	valuesUtf16 := make([][]uint16, 0, len(values))
 	for k := range values {
 		valuesUtf16 = append(valuesUtf16, utf16.Encode([]rune(k)))
 	}
 	sort.Slice(valuesUtf16, func(i, j int) bool { return CompareUtf16String(valuesUtf16[i], valuesUtf16[j]) < 0 })
-	valueTrie, _ := BuildLoudsDoubleTrie(valuesUtf16)
+	valueTrie, err := BuildTrie(trieType, valuesUtf16)
+	if err != nil {
+		return nil, err
+	}
 
 	// build mapping from key trie to value trie
 	mappingCount := 0
@@ -61,18 +282,30 @@ func BuildDictionaryFromMigemoDictFile(fp io.Reader) *CompactDictionary {
 		mappingCount += len(v)
 	}
 	mapping := make([]uint32, mappingCount)
+	var mappingWeights []uint8
+	if weights != nil {
+		mappingWeights = make([]uint8, mappingCount)
+	}
 	mappingIndex := 0
 	mappingBitList := NewBitList()
 	key := make([]uint16, 0, 16)
-	for i := 1; i <= keyTrie.Size(); i++ {
+	for i := 1; i <= keyTrie.Size()+1; i++ {
 		key = key[:0]
 		keyTrie.ReverseLookup(uint32(i), &key)
 		mappingBitList.Add(false)
-		values, ok := dict[string(utf16.Decode(key))]
+		keyString := string(utf16.Decode(key))
+		values, ok := dict[keyString]
 		if ok {
 			for j := 0; j < len(values); j++ {
 				mappingBitList.Add(true)
-				mapping[mappingIndex] = uint32(valueTrie.Lookup(utf16.Encode([]rune(values[j]))))
+				valueNode := valueTrie.Lookup(utf16.Encode([]rune(values[j])))
+				if valueNode <= 0 {
+					return nil, fmt.Errorf("migemo: value %q of key %q is not found in value trie", values[j], keyString)
+				}
+				mapping[mappingIndex] = uint32(valueNode)
+				if mappingWeights != nil {
+					mappingWeights[mappingIndex] = weights[keyString][j]
+				}
 				mappingIndex++
 			}
 		}
@@ -85,5 +318,6 @@ func BuildDictionaryFromMigemoDictFile(fp io.Reader) *CompactDictionary {
 		mapping:           mapping,
 		mappingBitVector:  mappingBitVector,
 		hasMappingBitList: createHasMappingBitList(mappingBitVector),
-	}
+		weights:           mappingWeights,
+	}, nil
 }
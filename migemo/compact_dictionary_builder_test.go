@@ -1,7 +1,9 @@
 package migemo_test
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"testing"
 	"unicode/utf16"
 
@@ -13,12 +15,77 @@ func TestLoadFromText(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	dict := migemo.BuildDictionaryFromMigemoDictFile(f)
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 	matches := make([]string, 0, 2)
 	dict.PredictiveSearch(utf16.Encode([]rune("おお")), func(word []uint16) {
 		matches = append(matches, string(utf16.Decode(word)))
 	})
-	if matches[1] != "大分県" || matches[0] != "大阪府" {
+	if len(matches) != 2 || !(matches[0] == "大阪府" && matches[1] == "大分県" || matches[0] == "大分県" && matches[1] == "大阪府") {
 		t.Errorf("expected:[大阪府 大分県] actual:%v", matches)
 	}
 }
+
+func TestLoadFromText_LastNode(t *testing.T) {
+	f, err := os.Open("../testdata/todofuken.txt")
+	if err != nil {
+		panic(err)
+	}
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := make([]string, 0, 1)
+	dict.Search(utf16.Encode([]rune("しがけん")), func(word []uint16) {
+		matches = append(matches, string(utf16.Decode(word)))
+	})
+	if len(matches) != 1 || matches[0] != "滋賀県" {
+		t.Errorf("expected:[滋賀県] actual:%v", matches)
+	}
+}
+
+func TestLoadFromText_Warnings(t *testing.T) {
+	text := "; comment\n" +
+		"あい\t愛\t藍\n" +
+		"\t愛\n" +
+		"あい\t哀\t愛\n" +
+		"いか\t\t烏賊\n" +
+		"うみ\n"
+	options := &migemo.BuildOptions{}
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []migemo.BuildWarning{
+		{Line: 3, Kind: migemo.WarningSkippedKey, Key: ""},
+		{Line: 4, Kind: migemo.WarningDuplicateKey, Key: "あい"},
+		{Line: 5, Kind: migemo.WarningEmptyValue, Key: "いか"},
+		{Line: 6, Kind: migemo.WarningEmptyValue, Key: "うみ"},
+	}
+	if len(options.Warnings) != len(expected) {
+		t.Fatalf("expected:%v actual:%v", expected, options.Warnings)
+	}
+	for i, w := range expected {
+		if options.Warnings[i] != w {
+			t.Errorf("expected:%v actual:%v", w, options.Warnings[i])
+		}
+	}
+	matches := make([]string, 0, 3)
+	dict.Search(utf16.Encode([]rune("あい")), func(word []uint16) {
+		matches = append(matches, string(utf16.Decode(word)))
+	})
+	if strings.Join(matches, " ") != "愛 藍 哀" {
+		t.Errorf("expected:[愛 藍 哀] actual:%v", matches)
+	}
+
+	_, err = migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{Strict: true})
+	if !errors.Is(err, migemo.ErrBuildWarning) {
+		t.Errorf("expected:%v actual:%v", migemo.ErrBuildWarning, err)
+	}
+	_, err = migemo.BuildDictionaryU8FromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{Strict: true})
+	if !errors.Is(err, migemo.ErrBuildWarning) {
+		t.Errorf("expected:%v actual:%v", migemo.ErrBuildWarning, err)
+	}
+}
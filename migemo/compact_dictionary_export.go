@@ -0,0 +1,73 @@
+package migemo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrUnexportableWord は、migemo-dict形式では書き表せない読みや単語があることを示す
+var ErrUnexportableWord = errors.New("migemo: word cannot be exported in migemo-dict format")
+
+// Export は、辞書の内容をmigemo-dict形式でfpに書き出す。
+// 読みはUTF-16の辞書順に並べ、各読みの単語は格納された順に出力する。
+// 単語の重みを持つ辞書では、BuildOptions.Weightedで読み込める"単語;重み"の形式で出力する。
+// 重みを持たない辞書の出力はWeightedを指定せずに読み込む。指定すると、";数字"で終わる単語の末尾を重みとみなす。
+// タブや改行を含む読みや単語、";"で始まる読みは書き表せないので、その読みの行を書き出す前にErrUnexportableWordを返す
+func (compactDictionary *CompactDictionary) Export(fp io.Writer) error {
+	type entry struct {
+		key  []uint16
+		node int
+	}
+	entries := make([]entry, 0, compactDictionary.hasMappingBitList.Size)
+	for i := 2; i < compactDictionary.hasMappingBitList.Size; i++ {
+		if !compactDictionary.hasMappingBitList.Get(i) {
+			continue
+		}
+		key := make([]uint16, 0, 8)
+		compactDictionary.keyTrie.ReverseLookup(uint32(i), &key)
+		entries = append(entries, entry{key, i})
+	}
+	sort.Slice(entries, func(i, j int) bool { return CompareUtf16String(entries[i].key, entries[j].key) < 0 })
+
+	writer := bufio.NewWriter(fp)
+	word := make([]uint16, 0, 16)
+	words := make([]string, 0, 16)
+	for _, e := range entries {
+		key := string(utf16.Decode(e.key))
+		if strings.HasPrefix(key, ";") || strings.ContainsAny(key, "\t\r\n") {
+			writer.Flush()
+			return fmt.Errorf("%w: key %q", ErrUnexportableWord, key)
+		}
+		start, end := compactDictionary.mappingRange(e.node)
+		words = words[:0]
+		for j := start; j < end; j++ {
+			word = word[:0]
+			compactDictionary.valueTrie.ReverseLookup(compactDictionary.mapping[j], &word)
+			w := string(utf16.Decode(word))
+			if strings.ContainsAny(w, "\t\r\n") {
+				writer.Flush()
+				return fmt.Errorf("%w: word %q of key %q", ErrUnexportableWord, w, key)
+			}
+			words = append(words, w)
+		}
+		writer.WriteString(key)
+		for i, w := range words {
+			writer.WriteByte('\t')
+			writer.WriteString(w)
+			if compactDictionary.weights != nil {
+				writer.WriteByte(';')
+				writer.WriteString(strconv.Itoa(int(compactDictionary.weights[start+uint(i)])))
+			}
+		}
+		if err := writer.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,487 @@
+package migemo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// TrieType は、辞書ファイルに格納されたトライの種類を表す
+type TrieType uint8
+
+const (
+	// TrieTypeLouds は、LoudsTrieU16を表す
+	TrieTypeLouds TrieType = iota + 1
+	// TrieTypeDouble は、LoudsDoubleTrieを表す
+	TrieTypeDouble
+	// TrieTypePrefix は、LoudsPrefixTrieを表す
+	TrieTypePrefix
+	// TrieTypePatricia は、LoudsPatriciaTrieを表す
+	TrieTypePatricia
+)
+
+func (trieType TrieType) String() string {
+	switch trieType {
+	case TrieTypeLouds:
+		return "louds"
+	case TrieTypeDouble:
+		return "double"
+	case TrieTypePrefix:
+		return "prefix"
+	case TrieTypePatricia:
+		return "patricia"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(trieType))
+}
+
+// KeyEncoding は、辞書ファイルにおけるキートライのラベルの符号化方式を表す
+type KeyEncoding uint8
+
+const (
+	// KeyEncodingCompactHiragana は、ASCIIとひらがなを1バイトで格納する符号化方式。
+	// それ以外の文字は、エスケープ用の1バイトとUTF-16の2バイトで格納する
+	KeyEncodingCompactHiragana KeyEncoding = iota + 1
+	// KeyEncodingUTF16 は、UTF-16の2バイトで格納する符号化方式
+	KeyEncodingUTF16
+)
+
+func (keyEncoding KeyEncoding) String() string {
+	switch keyEncoding {
+	case KeyEncodingCompactHiragana:
+		return "compact-hiragana"
+	case KeyEncodingUTF16:
+		return "utf16"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(keyEncoding))
+}
+
+const (
+	dictionaryMagic      = "MGCD"
+	dictionaryVersion    = 1
+	dictionaryHeaderSize = 28
+)
+
+// dictionaryFlagWeights は、ペイロードの末尾に単語の重みを格納していることを示すヘッダのフラグ
+const dictionaryFlagWeights = 1 << 0
+
+var (
+	// ErrInvalidMagic は、辞書ファイルのマジックナンバーが一致しないことを示す
+	ErrInvalidMagic = errors.New("migemo: not a compact dictionary (invalid magic number)")
+	// ErrUnsupportedVersion は、辞書ファイルのバージョンに対応していないことを示す
+	ErrUnsupportedVersion = errors.New("migemo: unsupported dictionary version")
+	// ErrUnsupportedTrieType は、辞書ファイルのトライの種類に対応していないことを示す
+	ErrUnsupportedTrieType = errors.New("migemo: unsupported trie type")
+	// ErrUnsupportedKeyEncoding は、辞書ファイルのキーの符号化方式に対応していないことを示す
+	ErrUnsupportedKeyEncoding = errors.New("migemo: unsupported key encoding")
+	// ErrChecksumMismatch は、辞書ファイルのCRCが一致しないことを示す
+	ErrChecksumMismatch = errors.New("migemo: dictionary checksum mismatch")
+	// ErrCorruptDictionary は、辞書ファイルの内容がヘッダと一致しないことを示す
+	ErrCorruptDictionary = errors.New("migemo: corrupt dictionary")
+)
+
+// dictionaryHeader は、辞書ファイルの先頭に置かれるヘッダ
+type dictionaryHeader struct {
+	// flags は、dictionaryFlagWeightsなどのフラグの組み合わせ
+	flags        uint8
+	version      uint8
+	trieType     TrieType
+	keyEncoding  KeyEncoding
+	keyNodes     uint32
+	valueNodes   uint32
+	mappings     uint32
+	payloadSize  uint32
+	payloadCRC32 uint32
+}
+
+func (header *dictionaryHeader) write(writer *binaryWriter) {
+	writer.buffer = append(writer.buffer, dictionaryMagic...)
+	writer.writeUint8(header.flags)
+	writer.writeUint8(header.version)
+	writer.writeUint8(uint8(header.trieType))
+	writer.writeUint8(uint8(header.keyEncoding))
+	writer.writeUint32(header.keyNodes)
+	writer.writeUint32(header.valueNodes)
+	writer.writeUint32(header.mappings)
+	writer.writeUint32(header.payloadSize)
+	writer.writeUint32(header.payloadCRC32)
+}
+
+func readDictionaryHeader(buffer []uint8) (*dictionaryHeader, error) {
+	if string(buffer[:len(dictionaryMagic)]) != dictionaryMagic {
+		return nil, ErrInvalidMagic
+	}
+	reader := newBinaryReader(buffer[len(dictionaryMagic):])
+	header := &dictionaryHeader{
+		flags:        reader.readUint8(),
+		version:      reader.readUint8(),
+		trieType:     TrieType(reader.readUint8()),
+		keyEncoding:  KeyEncoding(reader.readUint8()),
+		keyNodes:     reader.readUint32(),
+		valueNodes:   reader.readUint32(),
+		mappings:     reader.readUint32(),
+		payloadSize:  reader.readUint32(),
+		payloadCRC32: reader.readUint32(),
+	}
+	if header.version != dictionaryVersion && header.version != dictionaryVersionMapped {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header.version)
+	}
+	if header.flags&^dictionaryFlagWeights != 0 {
+		return nil, fmt.Errorf("%w: unknown flags %02x", ErrUnsupportedVersion, header.flags)
+	}
+	if header.trieType < TrieTypeLouds || TrieTypePatricia < header.trieType {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedTrieType, header.trieType)
+	}
+	if header.keyEncoding != KeyEncodingCompactHiragana && header.keyEncoding != KeyEncodingUTF16 ||
+		header.version == dictionaryVersionMapped && header.keyEncoding != KeyEncodingUTF16 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyEncoding, header.keyEncoding)
+	}
+	return header, nil
+}
+
+// NewCompactDictionary は、バイト配列からCompactDictionaryを読み込む。圧縮されていれば展開してから読み込む。
+// メモリマップ形式の辞書ではbufferを直接参照するため、読み込み後にbufferを変更してはならない
+func NewCompactDictionary(buffer []uint8) (*CompactDictionary, error) {
+	buffer, err := decompressBuffer(buffer)
+	if err != nil {
+		return nil, err
+	}
+	compactDictionary := &CompactDictionary{}
+	if err := compactDictionary.decode(buffer, true); err != nil {
+		return nil, err
+	}
+	return compactDictionary, nil
+}
+
+// ReadFrom は、rから辞書ファイルを読み込む。圧縮されていれば展開してから読み込む
+func (compactDictionary *CompactDictionary) ReadFrom(r io.Reader) (int64, error) {
+	counter := &countingReader{reader: r}
+	reader, err := NewDecompressingReader(counter)
+	if err != nil {
+		return counter.n, err
+	}
+	buffer := make([]uint8, dictionaryHeaderSize)
+	n, err := io.ReadFull(reader, buffer)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("%w: header is %d bytes, got %d", ErrUnexpectedEnd, dictionaryHeaderSize, n)
+		}
+		return counter.n, err
+	}
+	header, err := readDictionaryHeader(buffer)
+	if err != nil {
+		return counter.n, err
+	}
+	// payloadSizeは信頼できないので、あらかじめ確保せず、読めた分だけバッファを伸ばす
+	payload := bytes.NewBuffer(buffer)
+	m, err := payload.ReadFrom(io.LimitReader(reader, int64(header.payloadSize)))
+	if err != nil {
+		return counter.n, err
+	}
+	if m < int64(header.payloadSize) {
+		return counter.n, fmt.Errorf("%w: payload is %d bytes, got %d", ErrUnexpectedEnd, header.payloadSize, m)
+	}
+	buffer = payload.Bytes()
+	return counter.n, compactDictionary.decode(buffer, true)
+}
+
+// decode は、bufferから辞書を読み込む。checksumが偽なら、ペイロードのCRCを検査しない
+func (compactDictionary *CompactDictionary) decode(buffer []uint8, checksum bool) error {
+	if len(buffer) < dictionaryHeaderSize {
+		return fmt.Errorf("%w: header is %d bytes, got %d", ErrUnexpectedEnd, dictionaryHeaderSize, len(buffer))
+	}
+	header, err := readDictionaryHeader(buffer)
+	if err != nil {
+		return err
+	}
+	payload := buffer[dictionaryHeaderSize:]
+	if uint32(len(payload)) < header.payloadSize {
+		return fmt.Errorf("%w: payload is %d bytes, got %d", ErrUnexpectedEnd, header.payloadSize, len(payload))
+	}
+	if uint32(len(payload)) > header.payloadSize {
+		return fmt.Errorf("%w: %d trailing bytes", ErrCorruptDictionary, uint32(len(payload))-header.payloadSize)
+	}
+	if checksum {
+		if err := checkPayloadCRC32(buffer); err != nil {
+			return err
+		}
+	}
+	var keyTrie, valueTrie Trie
+	var mappingBitVector *BitVector
+	var mapping []uint32
+	var hasMappingBitList *BitList
+	var weights []uint8
+	if header.version == dictionaryVersionMapped {
+		reader := newMappedReader(buffer, dictionaryHeaderSize)
+		keyTrie = reader.readTrie(header.trieType)
+		valueTrie = reader.readTrie(header.trieType)
+		mappingBitVector = reader.readBitVector()
+		mapping = reader.readUint32Array()
+		hasMappingBitList = reader.readBitList()
+		if header.flags&dictionaryFlagWeights != 0 {
+			weights = reader.readUint8Array()
+		}
+		err = checkReaderEnd(&reader.binaryReader)
+	} else {
+		reader := newBinaryReader(buffer)
+		reader.offset = dictionaryHeaderSize
+		keyTrie = readTrie(reader, header.trieType, header.keyEncoding)
+		valueTrie = readTrie(reader, header.trieType, KeyEncodingUTF16)
+		mappingBitVector = reader.readBitVector()
+		mapping = reader.readUint32Array()
+		// 重みは省略可能で、ヘッダのフラグが立っていれば末尾に格納する
+		if header.flags&dictionaryFlagWeights != 0 {
+			weights = reader.readUint8Array()
+		}
+		err = checkReaderEnd(reader)
+		if err == nil {
+			hasMappingBitList = createHasMappingBitList(mappingBitVector)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if uint32(keyTrie.Size()) != header.keyNodes || uint32(valueTrie.Size()) != header.valueNodes || uint32(len(mapping)) != header.mappings {
+		return fmt.Errorf("%w: entry counts do not match header", ErrCorruptDictionary)
+	}
+	if header.flags&dictionaryFlagWeights != 0 && len(weights) != len(mapping) {
+		return fmt.Errorf("%w: %d weights for %d mappings", ErrCorruptDictionary, len(weights), len(mapping))
+	}
+	compactDictionary.keyTrie = keyTrie
+	compactDictionary.valueTrie = valueTrie
+	compactDictionary.mappingBitVector = mappingBitVector
+	compactDictionary.mapping = mapping
+	compactDictionary.hasMappingBitList = hasMappingBitList
+	compactDictionary.weights = weights
+	return nil
+}
+
+// checkPayloadCRC32 は、ヘッダーを読み込み済みの辞書ファイルbufferについて、ペイロードのCRCを検査する
+func checkPayloadCRC32(buffer []uint8) error {
+	expected := binary.BigEndian.Uint32(buffer[dictionaryHeaderSize-4:])
+	if crc := crc32.ChecksumIEEE(buffer[dictionaryHeaderSize:]); crc != expected {
+		return fmt.Errorf("%w: expected %08x, got %08x", ErrChecksumMismatch, expected, crc)
+	}
+	return nil
+}
+
+func checkReaderEnd(reader *binaryReader) error {
+	if reader.err != nil {
+		return fmt.Errorf("%w at offset %d", reader.err, reader.offset)
+	}
+	if reader.offset != len(reader.buffer) {
+		return fmt.Errorf("%w: %d unread bytes in payload", ErrCorruptDictionary, len(reader.buffer)-reader.offset)
+	}
+	return nil
+}
+
+// WriteTo は、辞書ファイルをwに書き込む。単語の重みを持つ辞書では、ヘッダにdictionaryFlagWeightsを立て、重みをペイロードの末尾に格納する
+func (compactDictionary *CompactDictionary) WriteTo(w io.Writer) (int64, error) {
+	trieType := compactDictionary.TrieType()
+	if trieType == 0 {
+		return 0, fmt.Errorf("%w: %T", ErrUnsupportedTrieType, compactDictionary.keyTrie)
+	}
+	keyEncoding := KeyEncodingCompactHiragana
+	payload := &binaryWriter{}
+	writeTrie(payload, compactDictionary.keyTrie, keyEncoding)
+	writeTrie(payload, compactDictionary.valueTrie, KeyEncodingUTF16)
+	payload.writeBitVector(compactDictionary.mappingBitVector)
+	payload.writeUint32Array(compactDictionary.mapping)
+	if compactDictionary.weights != nil {
+		payload.writeUint8Array(compactDictionary.weights)
+	}
+	header := &dictionaryHeader{
+		flags:        compactDictionary.headerFlags(),
+		version:      dictionaryVersion,
+		trieType:     trieType,
+		keyEncoding:  keyEncoding,
+		keyNodes:     uint32(compactDictionary.keyTrie.Size()),
+		valueNodes:   uint32(compactDictionary.valueTrie.Size()),
+		mappings:     uint32(len(compactDictionary.mapping)),
+		payloadSize:  uint32(len(payload.buffer)),
+		payloadCRC32: crc32.ChecksumIEEE(payload.buffer),
+	}
+	writer := &binaryWriter{
+		buffer: make([]uint8, 0, dictionaryHeaderSize+len(payload.buffer)),
+	}
+	header.write(writer)
+	writer.buffer = append(writer.buffer, payload.buffer...)
+	n, err := w.Write(writer.buffer)
+	return int64(n), err
+}
+
+// headerFlags は、辞書ファイルのヘッダに書き込むフラグを返す
+func (compactDictionary *CompactDictionary) headerFlags() uint8 {
+	if compactDictionary.weights != nil {
+		return dictionaryFlagWeights
+	}
+	return 0
+}
+
+// WriteCompressedTo は、辞書ファイルを圧縮形式compressionで圧縮してwに書き込む。
+// 戻り値は、wに書き込んだ圧縮後のバイト数
+func (compactDictionary *CompactDictionary) WriteCompressedTo(w io.Writer, compression Compression) (int64, error) {
+	counter := &countingWriter{writer: w}
+	writer, err := NewCompressingWriter(counter, compression)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := compactDictionary.WriteTo(writer); err != nil {
+		writer.Close()
+		return counter.n, err
+	}
+	err = writer.Close()
+	return counter.n, err
+}
+
+// WriteMappableTo は、メモリマップで読み込める形式(バージョン2)の辞書ファイルをwに書き込む。
+// 全ての配列はリトルエンディアンで8バイト境界に揃え、BitVectorの索引も格納する
+func (compactDictionary *CompactDictionary) WriteMappableTo(w io.Writer) (int64, error) {
+	trieType := compactDictionary.TrieType()
+	if trieType == 0 {
+		return 0, fmt.Errorf("%w: %T", ErrUnsupportedTrieType, compactDictionary.keyTrie)
+	}
+	writer := &mappedWriter{
+		buffer: make([]uint8, dictionaryHeaderSize),
+	}
+	writer.writeTrie(compactDictionary.keyTrie)
+	writer.writeTrie(compactDictionary.valueTrie)
+	writer.writeBitVector(compactDictionary.mappingBitVector)
+	writer.writeUint32Array(compactDictionary.mapping)
+	writer.writeBitList(compactDictionary.hasMappingBitList)
+	if compactDictionary.weights != nil {
+		writer.writeUint8Array(compactDictionary.weights)
+	}
+	payload := writer.buffer[dictionaryHeaderSize:]
+	header := &dictionaryHeader{
+		flags:        compactDictionary.headerFlags(),
+		version:      dictionaryVersionMapped,
+		trieType:     trieType,
+		keyEncoding:  KeyEncodingUTF16,
+		keyNodes:     uint32(compactDictionary.keyTrie.Size()),
+		valueNodes:   uint32(compactDictionary.valueTrie.Size()),
+		mappings:     uint32(len(compactDictionary.mapping)),
+		payloadSize:  uint32(len(payload)),
+		payloadCRC32: crc32.ChecksumIEEE(payload),
+	}
+	headerWriter := &binaryWriter{
+		buffer: writer.buffer[:0],
+	}
+	header.write(headerWriter)
+	n, err := w.Write(writer.buffer)
+	return int64(n), err
+}
+
+// readTrie は、trieTypeの種類のトライを読み込む
+func readTrie(reader *binaryReader, trieType TrieType, keyEncoding KeyEncoding) Trie {
+	switch trieType {
+	case TrieTypeLouds:
+		return readLoudsTrie(reader, keyEncoding)
+	case TrieTypeDouble:
+		return readLoudsDoubleTrie(reader, keyEncoding)
+	case TrieTypePrefix:
+		return &LoudsPrefixTrie{
+			trie:  readLoudsTrie(reader, keyEncoding),
+			outs:  reader.readBitVector(),
+			links: reader.readBitVector(),
+			tail:  readTail(reader, keyEncoding),
+		}
+	case TrieTypePatricia:
+		return &LoudsPatriciaTrie{
+			trie:  readLoudsTrie(reader, keyEncoding),
+			outs:  reader.readBitVector(),
+			links: reader.readBitVector(),
+			tail:  readTail(reader, keyEncoding),
+		}
+	}
+	reader.err = fmt.Errorf("%w: %s", ErrUnsupportedTrieType, trieType)
+	return nil
+}
+
+// writeTrie は、トライを書き込む。トライの種類はヘッダに格納する
+func writeTrie(writer *binaryWriter, trie Trie, keyEncoding KeyEncoding) {
+	switch trie := trie.(type) {
+	case *LoudsTrieU16:
+		writeLoudsTrie(writer, trie, keyEncoding)
+	case *LoudsDoubleTrie:
+		writeLoudsDoubleTrie(writer, trie, keyEncoding)
+	case *LoudsPrefixTrie:
+		writeLoudsTrie(writer, trie.trie, keyEncoding)
+		writer.writeBitVector(trie.outs)
+		writer.writeBitVector(trie.links)
+		writeTail(writer, trie.tail, keyEncoding)
+	case *LoudsPatriciaTrie:
+		writeLoudsTrie(writer, trie.trie, keyEncoding)
+		writer.writeBitVector(trie.outs)
+		writer.writeBitVector(trie.links)
+		writeTail(writer, trie.tail, keyEncoding)
+	}
+}
+
+func readTail(reader *binaryReader, keyEncoding KeyEncoding) *Tail {
+	return &Tail{
+		chars:   readLabels(reader, keyEncoding),
+		starts:  reader.readBitVector(),
+		shared:  reader.readBitVector(),
+		offsets: reader.readUint32Array(),
+	}
+}
+
+func writeTail(writer *binaryWriter, tail *Tail, keyEncoding KeyEncoding) {
+	writeLabels(writer, tail.chars, keyEncoding)
+	writer.writeBitVector(tail.starts)
+	writer.writeBitVector(tail.shared)
+	writer.writeUint32Array(tail.offsets)
+}
+
+func readLoudsDoubleTrie(reader *binaryReader, keyEncoding KeyEncoding) *LoudsDoubleTrie {
+	return &LoudsDoubleTrie{
+		prefixTrie:    readLoudsTrie(reader, keyEncoding),
+		tailTrie:      readLoudsTrie(reader, keyEncoding),
+		outs:          reader.readBitVector(),
+		linkBitVector: reader.readBitVector(),
+		linkArray:     reader.readUint32Array(),
+	}
+}
+
+func writeLoudsDoubleTrie(writer *binaryWriter, trie *LoudsDoubleTrie, keyEncoding KeyEncoding) {
+	writeLoudsTrie(writer, trie.prefixTrie, keyEncoding)
+	writeLoudsTrie(writer, trie.tailTrie, keyEncoding)
+	writer.writeBitVector(trie.outs)
+	writer.writeBitVector(trie.linkBitVector)
+	writer.writeUint32Array(trie.linkArray)
+}
+
+func readLoudsTrie(reader *binaryReader, keyEncoding KeyEncoding) *LoudsTrieU16 {
+	edges := readLabels(reader, keyEncoding)
+	return NewLoudsTrie(reader.readBitVector(), edges)
+}
+
+func writeLoudsTrie(writer *binaryWriter, trie *LoudsTrieU16, keyEncoding KeyEncoding) {
+	writeLabels(writer, trie.edges, keyEncoding)
+	writer.writeBitVector(trie.bitVector)
+}
+
+// readLabels は、keyEncodingで符号化されたラベルの配列を読み込む
+func readLabels(reader *binaryReader, keyEncoding KeyEncoding) []uint16 {
+	if keyEncoding != KeyEncodingCompactHiragana {
+		return reader.readUint16Array()
+	}
+	size := int(reader.readUint32())
+	labels := decodeCompact(reader.readUint8Array(), size)
+	if labels == nil && reader.err == nil {
+		reader.err = fmt.Errorf("%w: invalid compact key encoding", ErrCorruptDictionary)
+	}
+	return labels
+}
+
+func writeLabels(writer *binaryWriter, labels []uint16, keyEncoding KeyEncoding) {
+	if keyEncoding == KeyEncodingCompactHiragana {
+		writer.writeUint32(uint32(len(labels)))
+		writer.writeUint8Array(encodeCompact(labels))
+	} else {
+		writer.writeUint16Array(labels)
+	}
+}
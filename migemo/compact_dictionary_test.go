@@ -1,14 +1,36 @@
 package migemo_test
 
-/*
-func TestCompactDictionary_1(t *testing.T) {
-	f, err := os.Open("../testdata/todofuken-dict")
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func LoadCompactDictionary() *migemo.CompactDictionary {
+	buf, err := ioutil.ReadFile("../testdata/migemo-compact-dict")
 	if err != nil {
-		fmt.Println(err)
+		panic(err)
 	}
-	defer f.Close()
-	buf, err := ioutil.ReadAll(f)
-	dict := migemo.NewCompactDictionary(buf)
+	dict, err := migemo.NewCompactDictionary(buf)
+	if err != nil {
+		panic(err)
+	}
+	return dict
+}
+
+func TestCompactDictionary_1(t *testing.T) {
+	dict := LoadCompactDictionary()
 	list := []string{}
 	fn := func(s []uint16) {
 		list = append(list, string(utf16.Decode(s)))
@@ -21,19 +43,14 @@ func TestCompactDictionary_1(t *testing.T) {
 	}
 	t.Error()
 }
+
 func TestCompactDictionary_2(t *testing.T) {
-	f, err := os.Open("../testdata/todofuken-dict")
-	if err != nil {
-		fmt.Println(err)
-	}
-	defer f.Close()
-	buf, err := ioutil.ReadAll(f)
-	dict := migemo.NewCompactDictionary(buf)
+	dict := LoadCompactDictionary()
 	list := []string{}
 	fn := func(s []uint16) {
 		list = append(list, string(utf16.Decode(s)))
 	}
-	dict.PredictiveSearch(utf16.Encode([]rune("か")), fn)
+	dict.PredictiveSearch(utf16.Encode([]rune("かながわ")), fn)
 	for _, w := range list {
 		if w == "神奈川県" {
 			return
@@ -41,4 +58,518 @@ func TestCompactDictionary_2(t *testing.T) {
 	}
 	t.Error()
 }
-*/
+
+func TestCompactDictionary_WriteTo(t *testing.T) {
+	f, err := os.Open("../testdata/todofuken.txt")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := dict.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("invalid size. expected:%d actual:%d", buf.Len(), n)
+	}
+	loaded := &migemo.CompactDictionary{}
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	list := []string{}
+	loaded.Search(utf16.Encode([]rune("おおさかふ")), func(s []uint16) {
+		list = append(list, string(utf16.Decode(s)))
+	})
+	if len(list) != 1 || list[0] != "大阪府" {
+		t.Errorf("expected:[大阪府] actual:%v", list)
+	}
+}
+
+func TestCompactDictionary_WeightsFlag(t *testing.T) {
+	text := "か\t蚊;10\t課;200\nかい\t貝;120\n"
+	weighted, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{Weighted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, write := range []string{"WriteTo", "WriteMappableTo"} {
+		encode := func(dict *migemo.CompactDictionary) []byte {
+			var buf bytes.Buffer
+			if write == "WriteTo" {
+				dict.WriteTo(&buf)
+			} else {
+				dict.WriteMappableTo(&buf)
+			}
+			return buf.Bytes()
+		}
+		// ヘッダの5バイト目がフラグで、重みを持つ辞書では最下位ビットが立つ
+		data := encode(weighted)
+		if data[4] != 1 {
+			t.Fatalf("%s: weights flag is not set: %02x", write, data[4])
+		}
+		data[4] = 0
+		if _, err := migemo.NewCompactDictionary(data); !errors.Is(err, migemo.ErrCorruptDictionary) {
+			t.Errorf("%s: weights without the flag. actual:%v", write, err)
+		}
+		data = encode(plain)
+		if data[4] != 0 {
+			t.Fatalf("%s: weights flag is set: %02x", write, data[4])
+		}
+		data[4] = 1
+		if _, err := migemo.NewCompactDictionary(data); err == nil {
+			t.Errorf("%s: the flag without weights must fail", write)
+		}
+		data[4] = 0x80
+		if _, err := migemo.NewCompactDictionary(data); !errors.Is(err, migemo.ErrUnsupportedVersion) {
+			t.Errorf("%s: unknown flag. actual:%v", write, err)
+		}
+	}
+}
+
+func TestCompactDictionary_ReadFrom_Invalid(t *testing.T) {
+	f, err := os.Open("../testdata/todofuken.txt")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	dict.WriteTo(&buf)
+	data := buf.Bytes()
+
+	if _, err := migemo.NewCompactDictionary(data[:len(data)-1]); !errors.Is(err, migemo.ErrUnexpectedEnd) {
+		t.Errorf("truncated payload. actual:%v", err)
+	}
+	if _, err := migemo.NewCompactDictionary(data[:10]); !errors.Is(err, migemo.ErrUnexpectedEnd) {
+		t.Errorf("truncated header. actual:%v", err)
+	}
+	if _, err := (&migemo.CompactDictionary{}).ReadFrom(bytes.NewReader(data[:len(data)-1])); !errors.Is(err, migemo.ErrUnexpectedEnd) {
+		t.Errorf("truncated stream. actual:%v", err)
+	}
+	// 壊れたヘッダーのペイロードの長さだけ、あらかじめメモリを確保してはならない
+	huge := append([]byte{}, data...)
+	binary.BigEndian.PutUint32(huge[20:24], 0xffffffff)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := (&migemo.CompactDictionary{}).ReadFrom(bytes.NewReader(huge)); !errors.Is(err, migemo.ErrUnexpectedEnd) {
+		t.Errorf("huge payload size. actual:%v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+		t.Errorf("huge payload size allocated %d bytes", allocated)
+	}
+	broken := append([]byte{}, data...)
+	broken[0] = 'X'
+	if _, err := migemo.NewCompactDictionary(broken); !errors.Is(err, migemo.ErrInvalidMagic) {
+		t.Errorf("invalid magic. actual:%v", err)
+	}
+	broken = append([]byte{}, data...)
+	broken[6] = 0x7f
+	if _, err := migemo.NewCompactDictionary(broken); !errors.Is(err, migemo.ErrUnsupportedTrieType) {
+		t.Errorf("unknown trie type. actual:%v", err)
+	}
+	broken = append([]byte{}, data...)
+	broken[len(broken)-1] ^= 0xff
+	if _, err := migemo.NewCompactDictionary(broken); !errors.Is(err, migemo.ErrChecksumMismatch) {
+		t.Errorf("checksum. actual:%v", err)
+	}
+}
+
+func TestCompactDictionary_WideKeys(t *testing.T) {
+	text := "あい\t愛\n" +
+		"アイ\t愛\n" +
+		"らーめん\t拉麺\n" +
+		"ぶいえす・こーど\tVS Code\n" +
+		"ゔぁいおりん\tヴァイオリン\n" +
+		"ＡＢＣ\tABC\n" +
+		"\U0001F363\t寿司\n"
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := dict.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := migemo.NewCompactDictionary(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]string{
+		"あい":         "愛",
+		"アイ":         "愛",
+		"らーめん":       "拉麺",
+		"ぶいえす・こーど":   "VS Code",
+		"ゔぁいおりん":     "ヴァイオリン",
+		"ＡＢＣ":        "ABC",
+		"\U0001F363": "寿司",
+	}
+	for k, v := range data {
+		list := []string{}
+		loaded.Search(utf16.Encode([]rune(k)), func(s []uint16) {
+			list = append(list, string(utf16.Decode(s)))
+		})
+		if len(list) != 1 || list[0] != v {
+			t.Errorf("key:%s expected:[%s] actual:%v", k, v, list)
+		}
+	}
+}
+
+func TestCompactDictionary_Export(t *testing.T) {
+	text := "とうきょう\t東京\t東響\n" +
+		"かな\t仮名\t金\t哉\n" +
+		"かなさんどう\t金山堂\n" +
+		"らーめん\t拉麺\n"
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := dict.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "かな\t仮名\t金\t哉\n" +
+		"かなさんどう\t金山堂\n" +
+		"とうきょう\t東京\t東響\n" +
+		"らーめん\t拉麺\n"
+	if buf.String() != expected {
+		t.Errorf("expected:%q actual:%q", expected, buf.String())
+	}
+
+	exported := LoadCompactDictionary()
+	buf.Reset()
+	if err := exported.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	first := buf.String()
+	rebuilt, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(first), &migemo.BuildOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	rebuilt.Export(&buf)
+	if buf.String() != first {
+		t.Error("exported text is changed by round trip")
+	}
+}
+
+func TestCompactDictionary_Export_Separators(t *testing.T) {
+	// 単語の末尾の";数字"は、重みを持つ辞書では重みの前に残り、重みを持たない辞書ではそのまま書き出す
+	for _, weighted := range []bool{false, true} {
+		text := "かず\ta;1;5\tb;\n"
+		if !weighted {
+			text = "かず\ta;1\tb;\n"
+		}
+		dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{Weighted: weighted})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := dict.Export(&buf); err != nil {
+			t.Fatal(err)
+		}
+		rebuilt, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(buf.String()), &migemo.BuildOptions{Weighted: weighted, Strict: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := strings.Join(collectWords(rebuilt.Search, "かず"), " "); actual != "a;1 b;" {
+			t.Errorf("weighted:%t expected:%q actual:%q", weighted, "a;1 b;", actual)
+		}
+	}
+
+	// タブや改行を含む単語は、migemo-dict形式で書き表せない
+	for _, word := range []string{`a\011b`, `a\012b`} {
+		jisyo, err := migemo.ReadSkkJisyo(strings.NewReader("たぶ /(concat \""+word+"\")/\n"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dict, err := jisyo.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dict.Export(ioutil.Discard); !errors.Is(err, migemo.ErrUnexportableWord) {
+			t.Errorf("%s: expected ErrUnexportableWord, actual:%v", word, err)
+		}
+	}
+}
+
+func TestCompactDictionary_TrieTypes(t *testing.T) {
+	text := "かな\t仮名\t金\t哉\n" +
+		"かなさんどう\t金山堂\n" +
+		"かに\t蟹\n" +
+		"とうきょう\t東京\t東響\n" +
+		"とうきょうと\t東京都\n" +
+		"らーめん\t拉麺\n"
+	trieTypes := []migemo.TrieType{migemo.TrieTypeLouds, migemo.TrieTypeDouble, migemo.TrieTypePrefix, migemo.TrieTypePatricia}
+	for _, trieType := range trieTypes {
+		dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{TrieType: trieType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v1, v2 bytes.Buffer
+		if _, err := dict.WriteTo(&v1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dict.WriteMappableTo(&v2); err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range [][]byte{v1.Bytes(), v2.Bytes()} {
+			loaded, err := migemo.NewCompactDictionary(data)
+			if err != nil {
+				t.Fatalf("%s: %v", trieType, err)
+			}
+			if loaded.TrieType() != trieType {
+				t.Errorf("expected:%s actual:%s", trieType, loaded.TrieType())
+			}
+			if err := loaded.Verify(); err != nil {
+				t.Errorf("%s: %v", trieType, err)
+			}
+			list := []string{}
+			loaded.Search(utf16.Encode([]rune("とうきょう")), func(s []uint16) {
+				list = append(list, string(utf16.Decode(s)))
+			})
+			if strings.Join(list, ",") != "東京,東響" {
+				t.Errorf("%s: search. actual:%v", trieType, list)
+			}
+			list = collectWords(loaded.PredictiveSearch, "かな")
+			if strings.Join(list, ",") != "仮名,哉,金,金山堂" {
+				t.Errorf("%s: predictive search. actual:%v", trieType, list)
+			}
+			var exported bytes.Buffer
+			loaded.Export(&exported)
+			if exported.String() != "かな\t仮名\t金\t哉\nかなさんどう\t金山堂\nかに\t蟹\nとうきょう\t東京\t東響\nとうきょうと\t東京都\nらーめん\t拉麺\n" {
+				t.Errorf("%s: export. actual:%q", trieType, exported.String())
+			}
+		}
+	}
+	if _, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{TrieType: 0x7f}); !errors.Is(err, migemo.ErrUnsupportedTrieType) {
+		t.Errorf("unknown trie type. actual:%v", err)
+	}
+}
+
+func TestCompactDictionary_PredictiveSearch_PartialTail(t *testing.T) {
+	text := "かな\t仮名\n" +
+		"かなさんどう\t金山堂\n" +
+		"かに\t蟹\n"
+	for _, trieType := range []migemo.TrieType{migemo.TrieTypeLouds, migemo.TrieTypeDouble, migemo.TrieTypePrefix, migemo.TrieTypePatricia} {
+		dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{TrieType: trieType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"かなさ", "かなさんど", "かなさんどう"} {
+			if list := collectWords(dict.PredictiveSearch, key); len(list) != 1 || list[0] != "金山堂" {
+				t.Errorf("%s: key:%s expected:[金山堂] actual:%v", trieType, key, list)
+			}
+			list := []string{}
+			dict.PredictiveSearchWeighted(utf16.Encode([]rune(key)), func(s []uint16, weight uint8) {
+				list = append(list, string(utf16.Decode(s)))
+			})
+			if len(list) != 1 || list[0] != "金山堂" {
+				t.Errorf("%s: key:%s expected:[金山堂] actual:%v", trieType, key, list)
+			}
+		}
+		if list := collectWords(dict.Search, "かなさんど"); len(list) != 0 {
+			t.Errorf("%s: partial key must not match exactly. actual:%v", trieType, list)
+		}
+		if list := collectWords(dict.PredictiveSearch, "かなさんどうx"); len(list) != 0 {
+			t.Errorf("%s: expected:[] actual:%v", trieType, list)
+		}
+	}
+}
+
+func TestCompactDictionary_CommonPrefixSearch(t *testing.T) {
+	text := "か\t蚊\t可\n" +
+		"かな\t仮名\n" +
+		"かなさんどう\t金山堂\n" +
+		"かに\t蟹\n" +
+		"さん\t三\n"
+	for _, trieType := range []migemo.TrieType{migemo.TrieTypeLouds, migemo.TrieTypeDouble, migemo.TrieTypePrefix, migemo.TrieTypePatricia} {
+		dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{TrieType: trieType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := map[string]string{
+			"かなさんどうです": "1:蚊 1:可 2:仮名 6:金山堂",
+			"かなさんど":    "1:蚊 1:可 2:仮名",
+			"かにかま":     "1:蚊 1:可 2:蟹",
+			"さんかな":     "2:三",
+			"な":        "",
+		}
+		for key, expected := range data {
+			list := []string{}
+			dict.CommonPrefixSearch(utf16.Encode([]rune(key)), func(keyLen int, word []uint16) {
+				list = append(list, fmt.Sprintf("%d:%s", keyLen, string(utf16.Decode(word))))
+			})
+			if actual := strings.Join(list, " "); actual != expected {
+				t.Errorf("%s: key:%s expected:%q actual:%q", trieType, key, expected, actual)
+			}
+		}
+	}
+}
+
+func TestCompactDictionary_PredictiveSearchOrdered(t *testing.T) {
+	text := "かんじょう\t感情\t勘定\n" +
+		"かな\t仮名\t金\n" +
+		"かなさんどう\t金山堂\n" +
+		"かに\t蟹\n" +
+		"か\t蚊\n" +
+		"かんじ\t漢字\n" +
+		"さん\t三\n"
+	expected := "か:蚊 かな:仮名 かな:金 かなさんどう:金山堂 かに:蟹 かんじ:漢字 かんじょう:感情 かんじょう:勘定"
+	for _, trieType := range []migemo.TrieType{migemo.TrieTypeLouds, migemo.TrieTypeDouble, migemo.TrieTypePrefix, migemo.TrieTypePatricia} {
+		dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{TrieType: trieType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		search := func(key string, offset int, limit int) (string, bool) {
+			list := []string{}
+			more := dict.PredictiveSearchOrdered(utf16.Encode([]rune(key)), offset, limit, func(key []uint16, word []uint16) bool {
+				list = append(list, string(utf16.Decode(key))+":"+string(utf16.Decode(word)))
+				return true
+			})
+			return strings.Join(list, " "), more
+		}
+		if actual, more := search("か", 0, 0); actual != expected || more {
+			t.Errorf("%s: expected:%q actual:%q more:%v", trieType, expected, actual, more)
+		}
+		pages := []string{}
+		for offset := 0; ; offset += 3 {
+			page, more := search("か", offset, 3)
+			pages = append(pages, page)
+			if !more {
+				break
+			}
+		}
+		if actual := strings.Join(pages, " "); actual != expected || len(pages) != 3 {
+			t.Errorf("%s: pages:%q", trieType, pages)
+		}
+		if actual, more := search("かん", 1, 0); actual != "かんじょう:感情 かんじょう:勘定" || more {
+			t.Errorf("%s: offset. actual:%q more:%v", trieType, actual, more)
+		}
+		if actual, _ := search("かなさ", 0, 0); actual != "かなさんどう:金山堂" {
+			t.Errorf("%s: partial tail. actual:%q", trieType, actual)
+		}
+		count := 0
+		if !dict.PredictiveSearchOrdered(utf16.Encode([]rune("か")), 0, 0, func(key []uint16, word []uint16) bool {
+			count++
+			return count < 2
+		}) || count != 2 {
+			t.Errorf("%s: callback must stop the search. count:%d", trieType, count)
+		}
+	}
+}
+
+// randomDictionary は、"あいう"の3文字からなる読みをn個持つ辞書の本文と、読みの一覧を生成する。
+// 単語は読みに"語"を付けたもの
+func randomDictionary(random *rand.Rand, n int) (string, []string) {
+	set := make(map[string]bool)
+	for len(set) < n {
+		key := make([]rune, random.Intn(7)+1)
+		for i := range key {
+			key[i] = rune('あ' + 2*random.Intn(3))
+		}
+		set[string(key)] = true
+	}
+	keys := make([]string, 0, n)
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var builder strings.Builder
+	for _, key := range keys {
+		builder.WriteString(key + "\t" + key + "語\n")
+	}
+	return builder.String(), keys
+}
+
+// expectedPredictiveWords は、keysのうちprefixで始まる読みの単語をソートして返す
+func expectedPredictiveWords(keys []string, prefix string) []string {
+	words := []string{}
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			words = append(words, key+"語")
+		}
+	}
+	sort.Strings(words)
+	return words
+}
+
+func TestCompactDictionary_PredictiveSearchBounded_Random(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 300; trial++ {
+		text, keys := randomDictionary(random, random.Intn(40)+1)
+		dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, prefix := range []string{"あ", "い", "う", "いう", keys[len(keys)-1]} {
+			actual := []string{}
+			dict.PredictiveSearchBounded(utf16.Encode([]rune(prefix)), 0, func(word []uint16, weight uint8) {
+				actual = append(actual, string(utf16.Decode(word)))
+			})
+			sort.Strings(actual)
+			if expected := expectedPredictiveWords(keys, prefix); strings.Join(actual, ",") != strings.Join(expected, ",") {
+				t.Fatalf("keys:%v prefix:%s expected:%v actual:%v", keys, prefix, expected, actual)
+			}
+		}
+	}
+}
+
+func TestCompactDictionary_TrieTypes_Random(t *testing.T) {
+	trieTypes := []migemo.TrieType{migemo.TrieTypeLouds, migemo.TrieTypeDouble, migemo.TrieTypePrefix, migemo.TrieTypePatricia}
+	random := rand.New(rand.NewSource(2))
+	fixed := []string{"ああああいい", "あいうあいいう", "あういあうう", "あういう", "いうういうあ", "う", "ううあうあ", "うういう"}
+	for trial := 0; trial < 500; trial++ {
+		text, keys := randomDictionary(random, random.Intn(40)+1)
+		if trial == 0 {
+			keys = fixed
+			text = ""
+			for _, key := range keys {
+				text += key + "\t" + key + "語\n"
+			}
+		}
+		prefixes := []string{"あ", "い", "う", "いう", "ああ"}
+		for i := 0; i < 5; i++ {
+			key := []rune(keys[random.Intn(len(keys))])
+			prefixes = append(prefixes, string(key[:random.Intn(len(key))+1]))
+		}
+		for _, trieType := range trieTypes {
+			dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{TrieType: trieType})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, prefix := range prefixes {
+				expected := strings.Join(expectedPredictiveWords(keys, prefix), ",")
+				actual := collectWords(dict.PredictiveSearch, prefix)
+				sort.Strings(actual)
+				if strings.Join(actual, ",") != expected {
+					t.Fatalf("%s keys:%v prefix:%s expected:%v actual:%v", trieType, keys, prefix, expected, actual)
+				}
+				bounded := []string{}
+				dict.PredictiveSearchBounded(utf16.Encode([]rune(prefix)), 0, func(word []uint16, weight uint8) {
+					bounded = append(bounded, string(utf16.Decode(word)))
+				})
+				sort.Strings(bounded)
+				if strings.Join(bounded, ",") != expected {
+					t.Fatalf("%s keys:%v prefix:%s bounded expected:%v actual:%v", trieType, keys, prefix, expected, bounded)
+				}
+			}
+			for _, key := range keys {
+				if words := collectWords(dict.Search, key); len(words) != 1 || words[0] != key+"語" {
+					t.Fatalf("%s keys:%v search %s: %v", trieType, keys, key, words)
+				}
+			}
+		}
+	}
+}
@@ -1,11 +1,9 @@
 package migemo
 
 import (
-	"bufio"
+	"fmt"
 	"io"
 	"sort"
-	"strings"
-	"unicode/utf16"
 )
 
 // CompactDictionaryU8 は、読み毎に複数の単語を格納した辞書
@@ -18,32 +16,22 @@ type CompactDictionaryU8 struct {
 	hasMappingBitList *BitList
 }
 
-// NewCompactDictionary は、バイト配列からCompactDictionaryを読み込む
-/*
-func NewCompactDictionary(buffer []uint8) *CompactDictionary {
-	var offset = 0
-	keyTrie, offset := readTrie(buffer, offset, true)
-	valueTrie, offset := readTrie(buffer, offset, false)
-	var mappingBitVectorSize = binary.BigEndian.Uint32(buffer[offset:])
-	offset = offset + 4
-	var mappingBitVectorWords = make([]uint64, (mappingBitVectorSize+63)/64)
-	for i := 0; i < len(mappingBitVectorWords); i++ {
-		mappingBitVectorWords[i] = binary.BigEndian.Uint64(buffer[offset:])
-		offset = offset + 8
-	}
-	mappingBitVector := NewBitVector(mappingBitVectorWords, mappingBitVectorSize)
-	var mappingSize = binary.BigEndian.Uint32(buffer[offset:])
-	offset = offset + 4
-	mapping := make([]uint32, mappingSize)
-	for i := uint32(0); i < mappingSize; i++ {
-		mapping[i] = binary.BigEndian.Uint32(buffer[offset:])
-		offset += 4
+// NewCompactDictionaryU8 は、バイト配列からCompactDictionaryU8を読み込む
+func NewCompactDictionaryU8(buffer []uint8) *CompactDictionaryU8 {
+	buffer, err := decompressBuffer(buffer)
+	if err != nil {
+		return nil
 	}
-	if offset != len(buffer) {
+	reader := newBinaryReader(buffer)
+	keyTrie := readLoudsTrieU8(reader)
+	valueTrie := readLoudsTrieU8(reader)
+	mappingBitVector := reader.readBitVector()
+	mapping := reader.readUint32Array()
+	if reader.err != nil || reader.offset != len(buffer) {
 		return nil
 	}
 	hasMappingBitList := createHasMappingBitList(mappingBitVector)
-	return &CompactDictionary{
+	return &CompactDictionaryU8{
 		keyTrie,
 		valueTrie,
 		mappingBitVector,
@@ -51,7 +39,11 @@ func NewCompactDictionary(buffer []uint8) *CompactDictionary {
 		hasMappingBitList,
 	}
 }
-*/
+
+func readLoudsTrieU8(reader *binaryReader) *LoudsTrieU8 {
+	edges := reader.readUint8Array()
+	return NewLoudsTrieU8(reader.readBitVector(), edges)
+}
 
 // Search は、キーに一致する単語をコールバック関数fに返す
 func (compactDictionary *CompactDictionaryU8) Search(key []uint8, f func([]uint8)) {
@@ -94,57 +86,20 @@ func (compactDictionary *CompactDictionaryU8) PredictiveSearch(key []uint8, f fu
 }
 
 // Save は、ファイルに辞書の内容を書き込む
-/*
-func (compactDictionary *CompactDictionary) Save(fp *os.File) {
-	writer := bufio.NewWriter(fp)
-	buffer := make([]byte, 8)
-	// output key trie
-	keyTriEdgesLength := uint32((len(compactDictionary.keyTrie.edges)))
-	binary.BigEndian.PutUint32(buffer, keyTriEdgesLength)
-	writer.Write(buffer[0:4])
-	for i := 0; i < len(compactDictionary.keyTrie.edges); i++ {
-		buffer[0] = encode(compactDictionary.keyTrie.edges[i])
-		writer.Write(buffer[:1])
-	}
-	binary.BigEndian.PutUint32(buffer, uint32(compactDictionary.keyTrie.bitVector.Size()))
-	writer.Write(buffer[0:4])
-	keyTrieBitVectorWords := compactDictionary.keyTrie.bitVector.words
-	for i := 0; i < len(keyTrieBitVectorWords); i++ {
-		binary.BigEndian.PutUint64(buffer, keyTrieBitVectorWords[i])
-		writer.Write(buffer)
-	}
-	// output value trie
-	valueTriEdgesLength := uint32((len(compactDictionary.valueTrie.edges)))
-	binary.BigEndian.PutUint32(buffer, valueTriEdgesLength)
-	writer.Write(buffer[:4])
-	for i := 0; i < len(compactDictionary.valueTrie.edges); i++ {
-		binary.BigEndian.PutUint16(buffer, compactDictionary.valueTrie.edges[i])
-		writer.Write(buffer[:2])
-	}
-	binary.BigEndian.PutUint32(buffer, uint32(compactDictionary.valueTrie.bitVector.Size()))
-	writer.Write(buffer[0:4])
-	valueTrieBitVectorWords := compactDictionary.valueTrie.bitVector.words
-	for i := 0; i < len(valueTrieBitVectorWords); i++ {
-		binary.BigEndian.PutUint64(buffer, valueTrieBitVectorWords[i])
-		writer.Write(buffer)
-	}
+func (compactDictionary *CompactDictionaryU8) Save(fp io.Writer) error {
+	writer := &binaryWriter{}
+	writeLoudsTrieU8(writer, compactDictionary.keyTrie)
+	writeLoudsTrieU8(writer, compactDictionary.valueTrie)
+	writer.writeBitVector(compactDictionary.mappingBitVector)
+	writer.writeUint32Array(compactDictionary.mapping)
+	_, err := fp.Write(writer.buffer)
+	return err
+}
 
-	// output mapping trie
-	binary.BigEndian.PutUint32(buffer, uint32(compactDictionary.mappingBitVector.sizeInBits))
-	writer.Write(buffer[:4])
-	for _, w := range compactDictionary.mappingBitVector.words {
-		binary.BigEndian.PutUint64(buffer, w)
-		writer.Write(buffer)
-	}
-	binary.BigEndian.PutUint32(buffer, uint32(len(compactDictionary.mapping)))
-	writer.Write(buffer[:4])
-	for _, x := range compactDictionary.mapping {
-		binary.BigEndian.PutUint32(buffer, x)
-		writer.Write(buffer[:4])
-	}
-	writer.Flush()
+func writeLoudsTrieU8(writer *binaryWriter, trie *LoudsTrieU8) {
+	writer.writeUint8Array(trie.edges)
+	writer.writeBitVector(trie.bitVector)
 }
-*/
 
 // IoSize is ...
 func (compactDictionary *CompactDictionaryU8) IoSize() int {
@@ -156,35 +111,18 @@ func (compactDictionary *CompactDictionaryU8) NodeSize() (int, int) {
 	return compactDictionary.keyTrie.Size(), compactDictionary.valueTrie.Size()
 }
 
-// BuildDictionaryU8FromMigemoDictFile は、ファイルからCompactDictionaryを読み込む
-func BuildDictionaryU8FromMigemoDictFile(fp io.Reader) *CompactDictionaryU8 {
-	scanner := bufio.NewScanner(fp)
-	dict := make(map[string][]string)
-	keys := make([]string, 0, 1024)
-	values := make(map[string]struct{}, 1024)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, ";") || len(line) == 0 {
-			continue
-		}
-		columns := strings.Split(line, "\t")
-		key := columns[0]
-		var skip = false
-		for _, c := range utf16.Encode([]rune(key)) {
-			if encode(c) == 0 {
-				println("skip this word: ", key)
-				skip = true
-				break
-			}
-		}
-		if skip {
-			continue
-		}
-		keys = append(keys, key)
-		for _, w := range columns[1:] {
+// BuildDictionaryU8FromMigemoDictFile は、ファイルからCompactDictionaryを読み込む。
+// optionsがnilでなければ、読み込み中に発生した警告をoptions.Warningsに追加する
+func BuildDictionaryU8FromMigemoDictFile(fp io.Reader, options *BuildOptions) (*CompactDictionaryU8, error) {
+	keys, dict, _, err := readMigemoDict(fp, options)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]struct{}, len(keys))
+	for _, words := range dict {
+		for _, w := range words {
 			values[w] = struct{}{}
 		}
-		dict[key] = columns[1:]
 	}
 
 	// build key trie
@@ -218,7 +156,7 @@ func BuildDictionaryU8FromMigemoDictFile(fp io.Reader) *CompactDictionaryU8 {
 	mappingIndex := 0
 	mappingBitList := NewBitList()
 	key := make([]uint8, 0, 16)
-	for i := 1; i <= keyTrie.Size(); i++ {
+	for i := 1; i <= keyTrie.Size()+1; i++ {
 		key = key[:0]
 		keyTrie.ReverseLookup(uint32(i), &key)
 		mappingBitList.Add(false)
@@ -226,15 +164,11 @@ func BuildDictionaryU8FromMigemoDictFile(fp io.Reader) *CompactDictionaryU8 {
 		if ok {
 			for j := 0; j < len(words); j++ {
 				mappingBitList.Add(true)
-				a := valueTrie.Lookup([]byte(words[j]))
-				b := sort.SearchStrings(valuesUtf8, words[j])
-				if a <= 0 {
-					panic("")
+				valueNode := valueTrie.Lookup([]byte(words[j]))
+				if valueNode <= 0 {
+					return nil, fmt.Errorf("migemo: value %q of key %q is not found in value trie", words[j], string(key))
 				}
-				if valuesUtf8[b] != words[j] {
-					panic("")
-				}
-				mapping[mappingIndex] = uint32(a)
+				mapping[mappingIndex] = uint32(valueNode)
 				mappingIndex++
 			}
 		}
@@ -247,5 +181,5 @@ func BuildDictionaryU8FromMigemoDictFile(fp io.Reader) *CompactDictionaryU8 {
 		mapping:           mapping,
 		mappingBitVector:  mappingBitVector,
 		hasMappingBitList: createHasMappingBitList(mappingBitVector),
-	}
+	}, nil
 }
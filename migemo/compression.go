@@ -0,0 +1,180 @@
+package migemo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Compression は、辞書ファイルの圧縮形式
+type Compression int
+
+const (
+	// CompressionNone は、圧縮されていないことを示す
+	CompressionNone Compression = iota
+	// CompressionGzip は、gzip形式を示す
+	CompressionGzip
+	// CompressionZstd は、Zstandard形式を示す。使用するにはRegisterDecompressorとRegisterCompressorで実装を登録する
+	CompressionZstd
+)
+
+func (compression Compression) String() string {
+	switch compression {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("unknown(%d)", int(compression))
+}
+
+// ErrUnsupportedCompression は、圧縮形式の実装が登録されていないことを示す
+var ErrUnsupportedCompression = errors.New("migemo: unsupported compression")
+
+// Decompressor は、圧縮されたストリームrを展開するReaderを返す
+type Decompressor func(r io.Reader) (io.Reader, error)
+
+// Compressor は、wに圧縮して書き込むWriterを返す。圧縮を完了するには、返したWriterをCloseする
+type Compressor func(w io.Writer) (io.WriteCloser, error)
+
+var compressionMagics = []struct {
+	compression Compression
+	magic       []uint8
+}{
+	{CompressionGzip, []uint8{0x1f, 0x8b}},
+	{CompressionZstd, []uint8{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+var (
+	compressionMutex sync.RWMutex
+	decompressors    = map[Compression]Decompressor{
+		CompressionGzip: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+	}
+	compressors = map[Compression]Compressor{
+		CompressionGzip: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+	}
+)
+
+// RegisterDecompressor は、圧縮形式compressionを展開する実装を登録する。nilを指定すると登録を解除する
+func RegisterDecompressor(compression Compression, decompressor Decompressor) {
+	compressionMutex.Lock()
+	defer compressionMutex.Unlock()
+	if decompressor == nil {
+		delete(decompressors, compression)
+		return
+	}
+	decompressors[compression] = decompressor
+}
+
+// RegisterCompressor は、圧縮形式compressionで圧縮する実装を登録する。nilを指定すると登録を解除する
+func RegisterCompressor(compression Compression, compressor Compressor) {
+	compressionMutex.Lock()
+	defer compressionMutex.Unlock()
+	if compressor == nil {
+		delete(compressors, compression)
+		return
+	}
+	compressors[compression] = compressor
+}
+
+// DetectCompression は、先頭のマジックナンバーから圧縮形式を判定する
+func DetectCompression(b []uint8) Compression {
+	for _, m := range compressionMagics {
+		if bytes.HasPrefix(b, m.magic) {
+			return m.compression
+		}
+	}
+	return CompressionNone
+}
+
+// NewDecompressingReader は、rが圧縮されていれば展開するReaderを、そうでなければrと同じ内容を返すReaderを返す。
+// 圧縮形式の判定のために読み込むのはマジックナンバーの長さだけで、それ以上は先読みしない
+func NewDecompressingReader(r io.Reader) (io.Reader, error) {
+	head := make([]uint8, 4)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+	reader := io.MultiReader(bytes.NewReader(head), r)
+	compression := DetectCompression(head)
+	if compression == CompressionNone {
+		return reader, nil
+	}
+	compressionMutex.RLock()
+	decompressor, ok := decompressors[compression]
+	compressionMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCompression, compression)
+	}
+	return decompressor(reader)
+}
+
+// NewCompressingWriter は、wに圧縮形式compressionで書き込むWriterを返す。
+// 圧縮を完了するには、返したWriterをCloseする。Closeしてもwは閉じない
+func NewCompressingWriter(w io.Writer, compression Compression) (io.WriteCloser, error) {
+	if compression == CompressionNone {
+		return nopWriteCloser{w}, nil
+	}
+	compressionMutex.RLock()
+	compressor, ok := compressors[compression]
+	compressionMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCompression, compression)
+	}
+	return compressor(w)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// countingReader は、読み込んだバイト数を数える
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []uint8) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// countingWriter は、書き込んだバイト数を数える
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+func (w *countingWriter) Write(p []uint8) (int, error) {
+	n, err := w.writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// decompressBuffer は、bが圧縮されていれば展開したバイト配列を、そうでなければbをそのまま返す
+func decompressBuffer(b []uint8) ([]uint8, error) {
+	if DetectCompression(b) == CompressionNone {
+		return b, nil
+	}
+	r, err := NewDecompressingReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
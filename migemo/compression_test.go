@@ -0,0 +1,96 @@
+package migemo_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func TestCompression_Gzip(t *testing.T) {
+	var text bytes.Buffer
+	gz := gzip.NewWriter(&text)
+	gz.Write([]byte("おおさかふ\t大阪府\nきょうとふ\t京都府\n"))
+	gz.Close()
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(&text, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := dict.WriteCompressedTo(&buf, migemo.CompressionGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) || migemo.DetectCompression(buf.Bytes()) != migemo.CompressionGzip {
+		t.Fatalf("invalid compressed output. n:%d len:%d", n, buf.Len())
+	}
+	data := buf.Bytes()
+
+	loaded, err := migemo.NewCompactDictionary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := strings.Join(collectWords(loaded.Search, "きょうとふ"), " "); actual != "京都府" {
+		t.Errorf("NewCompactDictionary: %q", actual)
+	}
+	loaded = &migemo.CompactDictionary{}
+	if _, err := loaded.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if actual := strings.Join(collectWords(loaded.Search, "おおさかふ"), " "); actual != "大阪府" {
+		t.Errorf("ReadFrom: %q", actual)
+	}
+
+	dir, err := ioutil.TempDir("", "migemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dict.gz")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := migemo.OpenMappedDictionary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+	if actual := strings.Join(collectWords(mapped.Search, "おおさかふ"), " "); actual != "大阪府" {
+		t.Errorf("OpenMappedDictionary: %q", actual)
+	}
+}
+
+func TestCompression_Zstd(t *testing.T) {
+	zstdMagic := []byte{0x28, 0xb5, 0x2f, 0xfd}
+	text := append(append([]byte{}, zstdMagic...), "とうきょうと\t東京都\n"...)
+	if _, err := migemo.BuildDictionaryFromMigemoDictFile(bytes.NewReader(text), nil); !errors.Is(err, migemo.ErrUnsupportedCompression) {
+		t.Errorf("unregistered decompressor. actual:%v", err)
+	}
+
+	// マジックナンバーを取り除くだけの実装で、登録した実装が使われることを確かめる
+	migemo.RegisterDecompressor(migemo.CompressionZstd, func(r io.Reader) (io.Reader, error) {
+		if _, err := io.ReadFull(r, make([]byte, len(zstdMagic))); err != nil {
+			return nil, err
+		}
+		return r, nil
+	})
+	defer migemo.RegisterDecompressor(migemo.CompressionZstd, nil)
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(bytes.NewReader(text), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := strings.Join(collectWords(dict.Search, "とうきょうと"), " "); actual != "東京都" {
+		t.Errorf("expected:東京都 actual:%q", actual)
+	}
+	if _, err := dict.WriteCompressedTo(ioutil.Discard, migemo.CompressionZstd); !errors.Is(err, migemo.ErrUnsupportedCompression) {
+		t.Errorf("unregistered compressor. actual:%v", err)
+	}
+}
@@ -0,0 +1,31 @@
+// Package defaultdict は、ビルド済みの辞書を埋め込み、ファイルなしで使える既定の辞書を提供する
+package defaultdict
+
+//go:generate sh -c "gzip -9 -n -c ../../testdata/migemo-compact-dict > migemo-compact-dict.gz"
+
+import (
+	_ "embed" // 辞書の埋め込みに使う
+	"sync"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+//go:embed migemo-compact-dict.gz
+var data []byte
+
+var (
+	once       sync.Once
+	dictionary *migemo.CompactDictionary
+)
+
+// Default は、埋め込まれた辞書を返す。初回の呼び出しで辞書を読み込み、以降は同じ辞書を返す
+func Default() *migemo.CompactDictionary {
+	once.Do(func() {
+		dict, err := migemo.NewCompactDictionary(data)
+		if err != nil {
+			panic("defaultdict: embedded dictionary is broken: " + err.Error())
+		}
+		dictionary = dict
+	})
+	return dictionary
+}
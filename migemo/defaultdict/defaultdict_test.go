@@ -0,0 +1,22 @@
+package defaultdict_test
+
+import (
+	"testing"
+	"unicode/utf16"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo/defaultdict"
+)
+
+func TestDefault(t *testing.T) {
+	dict := defaultdict.Default()
+	if dict != defaultdict.Default() {
+		t.Error("Default must return the same dictionary")
+	}
+	found := false
+	dict.Search(utf16.Encode([]rune("とうきょうと")), func(s []uint16) {
+		found = found || string(utf16.Decode(s)) == "東京都"
+	})
+	if !found {
+		t.Error("東京都 is not found")
+	}
+}
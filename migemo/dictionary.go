@@ -0,0 +1,41 @@
+package migemo
+
+// Dictionary は、読みから単語を検索する辞書
+type Dictionary interface {
+	// Search は、キーに一致する単語をコールバック関数fに返す
+	Search(key []uint16, f func([]uint16))
+	// PredictiveSearch は、接頭辞がkeyに一致する全ての単語をコールバック関数fに返す
+	PredictiveSearch(key []uint16, f func([]uint16))
+}
+
+// WeightedDictionary は、単語毎の重みを持つ辞書
+type WeightedDictionary interface {
+	Dictionary
+	// HasWeights は、辞書が単語の重みを持つかを返す
+	HasWeights() bool
+	// PredictiveSearchWeighted は、接頭辞がkeyに一致する全ての単語を、その重みとともにコールバック関数fに返す
+	PredictiveSearchWeighted(key []uint16, f func(word []uint16, weight uint8))
+}
+
+// BoundedDictionary は、前方一致検索で巡るノード数を制限できる辞書
+type BoundedDictionary interface {
+	Dictionary
+	// PredictiveSearchBounded は、巡るノード数をmaxNodesまでに制限して前方一致検索し、単語とその重みをコールバック関数fに返す。
+	// maxNodesが0以下なら制限しない。巡ったノード数と、制限に達して検索を打ち切ったかを返す
+	PredictiveSearchBounded(key []uint16, maxNodes int, f func(word []uint16, weight uint8)) (int, bool)
+}
+
+// FuzzyDictionary は、読みの打ち間違いを許して検索できる辞書
+type FuzzyDictionary interface {
+	Dictionary
+	// FuzzySearch は、keyとの編集距離がmaxDistance以下の全ての読みについて、読みと単語、単語の重み、編集距離をコールバック関数fに返す
+	FuzzySearch(key []uint16, maxDistance int, f func(key []uint16, word []uint16, weight uint8, distance int))
+}
+
+// BoundedFuzzyDictionary は、読みの打ち間違いを許す検索で巡るノード数を制限できる辞書
+type BoundedFuzzyDictionary interface {
+	FuzzyDictionary
+	// FuzzySearchBounded は、巡るノード数をmaxNodesまでに制限してFuzzySearchと同様に検索する。
+	// maxNodesが0以下なら制限しない。巡ったノード数と、制限に達して検索を打ち切ったかを返す
+	FuzzySearchBounded(key []uint16, maxDistance int, maxNodes int, f func(key []uint16, word []uint16, weight uint8, distance int)) (int, bool)
+}
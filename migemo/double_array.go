@@ -19,9 +19,9 @@ func NewDoubleArray(base []int16, check []int16, code func(uint8) int, charSize
 }
 
 func (doubleArray *DoubleArray) traverse(n int16, k int) int16 {
-	m := doubleArray.base[n] + int16(k)
-	if doubleArray.check[m] == n {
-		return m
+	m := int(doubleArray.base[n]) + k
+	if m >= 0 && m < len(doubleArray.check) && doubleArray.check[m] == n {
+		return int16(m)
 	}
 	return -1
 }
@@ -0,0 +1,260 @@
+package migemo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"unicode/utf8"
+)
+
+// Encoding は、テキスト辞書の文字コード
+type Encoding int
+
+const (
+	// EncodingAuto は、文字コードを自動で判定することを示す
+	EncodingAuto Encoding = iota
+	// EncodingUTF8 は、UTF-8(BOMの有無は問わない)を示す
+	EncodingUTF8
+	// EncodingEUCJP は、EUC-JPを示す
+	EncodingEUCJP
+	// EncodingShiftJIS は、Shift_JIS(CP932)を示す
+	EncodingShiftJIS
+)
+
+func (encoding Encoding) String() string {
+	switch encoding {
+	case EncodingAuto:
+		return "auto"
+	case EncodingUTF8:
+		return "UTF-8"
+	case EncodingEUCJP:
+		return "EUC-JP"
+	case EncodingShiftJIS:
+		return "Shift_JIS"
+	}
+	return fmt.Sprintf("unknown(%d)", int(encoding))
+}
+
+var utf8Bom = []byte{0xef, 0xbb, 0xbf}
+
+var (
+	jisTableOnce sync.Once
+	jis0208Runes []rune
+	cp932Runes   []rune
+)
+
+func loadJisTables() {
+	jisTableOnce.Do(func() {
+		jis0208Runes = []rune(jis0208Table)
+		cp932Runes = []rune(cp932Table)
+	})
+}
+
+// DetectEncoding は、バイト列の文字コードを判定する。
+// UTF-8として正しければUTF-8とし、そうでなければEUC-JPとShift_JISのうち不正なバイト列が少ない方を返す
+func DetectEncoding(b []byte) Encoding {
+	if bytes.HasPrefix(b, utf8Bom) || utf8.Valid(b) {
+		return EncodingUTF8
+	}
+	eucErrors, eucKana := scanEucJp(b)
+	sjisErrors, sjisKana := scanShiftJis(b)
+	if eucErrors != sjisErrors {
+		if eucErrors < sjisErrors {
+			return EncodingEUCJP
+		}
+		return EncodingShiftJIS
+	}
+	if sjisKana > eucKana {
+		return EncodingShiftJIS
+	}
+	return EncodingEUCJP
+}
+
+// scanEucJp は、EUC-JPとして不正なバイト列の数と、ひらがなの数を返す
+func scanEucJp(b []byte) (int, int) {
+	errors, kana := 0, 0
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c < 0x80:
+		case c == 0x8e && i+1 < len(b) && 0xa1 <= b[i+1] && b[i+1] <= 0xdf:
+			i++
+		case c == 0x8f && i+2 < len(b) && isEucByte(b[i+1]) && isEucByte(b[i+2]):
+			i += 2
+		case isEucByte(c) && i+1 < len(b) && isEucByte(b[i+1]):
+			if c == 0xa4 {
+				kana++
+			}
+			i++
+		default:
+			errors++
+		}
+	}
+	return errors, kana
+}
+
+// scanShiftJis は、Shift_JISとして不正なバイト列の数と、ひらがなの数を返す
+func scanShiftJis(b []byte) (int, int) {
+	errors, kana := 0, 0
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c < 0x80 || (0xa1 <= c && c <= 0xdf):
+		case isSjisLeadByte(c) && i+1 < len(b) && isSjisTrailByte(b[i+1]):
+			if c == 0x82 && b[i+1] >= 0x9f {
+				kana++
+			}
+			i++
+		default:
+			errors++
+		}
+	}
+	return errors, kana
+}
+
+func isEucByte(c byte) bool {
+	return 0xa1 <= c && c <= 0xfe
+}
+
+func isSjisLeadByte(c byte) bool {
+	return (0x81 <= c && c <= 0x9f) || (0xe0 <= c && c <= 0xfc)
+}
+
+func isSjisTrailByte(c byte) bool {
+	return 0x40 <= c && c <= 0xfc && c != 0x7f
+}
+
+// decodeText は、指定された文字コードのバイト列をUTF-8に変換する。
+// 変換できないバイト列はU+FFFDに置き換え、その位置と長さを関数invalidに返す
+func decodeText(b []byte, encoding Encoding, invalid func(offset int, size int)) []byte {
+	if encoding == EncodingAuto {
+		encoding = DetectEncoding(b)
+	}
+	switch encoding {
+	case EncodingEUCJP:
+		return decodeEucJp(b, invalid)
+	case EncodingShiftJIS:
+		return decodeShiftJis(b, invalid)
+	}
+	return bytes.TrimPrefix(b, utf8Bom)
+}
+
+func decodeEucJp(b []byte, invalid func(offset int, size int)) []byte {
+	loadJisTables()
+	out := make([]byte, 0, len(b)*3/2)
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c < 0x80:
+			out = append(out, c)
+		case c == 0x8e && i+1 < len(b) && 0xa1 <= b[i+1] && b[i+1] <= 0xdf:
+			out = appendRune(out, 0xff61+rune(b[i+1]-0xa1))
+			i++
+		case c == 0x8f && i+2 < len(b) && isEucByte(b[i+1]) && isEucByte(b[i+2]):
+			// JIS X 0212の補助漢字は対応表を持たない
+			out = appendRune(out, utf8.RuneError)
+			invalid(i, 3)
+			i += 2
+		case isEucByte(c) && i+1 < len(b) && isEucByte(b[i+1]):
+			r := jis0208Runes[int(c-0xa1)*94+int(b[i+1]-0xa1)]
+			if r == utf8.RuneError {
+				invalid(i, 2)
+			}
+			out = appendRune(out, r)
+			i++
+		default:
+			out = appendRune(out, utf8.RuneError)
+			invalid(i, 1)
+		}
+	}
+	return out
+}
+
+func decodeShiftJis(b []byte, invalid func(offset int, size int)) []byte {
+	loadJisTables()
+	out := make([]byte, 0, len(b)*3/2)
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c < 0x80:
+			out = append(out, c)
+		case 0xa1 <= c && c <= 0xdf:
+			out = appendRune(out, 0xff61+rune(c-0xa1))
+		case isSjisLeadByte(c) && i+1 < len(b) && isSjisTrailByte(b[i+1]):
+			r := cp932Rune(c, b[i+1])
+			if r == utf8.RuneError {
+				invalid(i, 2)
+			}
+			out = appendRune(out, r)
+			i++
+		default:
+			out = appendRune(out, utf8.RuneError)
+			invalid(i, 1)
+		}
+	}
+	return out
+}
+
+// cp932Rune は、CP932の2バイト文字を変換する。外字領域は私用領域に割り当てる
+func cp932Rune(lead byte, trail byte) rune {
+	var row int
+	switch {
+	case lead <= 0x9f:
+		row = int(lead - 0x81)
+	case lead <= 0xef:
+		row = int(lead-0xe0) + 0x1f
+	case lead <= 0xf9:
+		cell := int(trail - 0x40)
+		if trail > 0x7f {
+			cell--
+		}
+		return 0xe000 + rune(int(lead-0xf0)*188+cell)
+	default:
+		row = int(lead-0xfa) + 0x2f
+	}
+	return cp932Runes[row*189+int(trail-0x40)]
+}
+
+func appendRune(b []byte, r rune) []byte {
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], r)
+	return append(b, buf[:n]...)
+}
+
+// newDecodingReader は、fpが圧縮されていれば展開し、options.Encodingの文字コードからUTF-8に変換したものを返す。
+// 変換できないバイト列は、WarningUndecodableSequenceの警告とする
+func newDecodingReader(fp io.Reader, options *BuildOptions) (io.Reader, error) {
+	encoding := options.encoding()
+	fp, err := NewDecompressingReader(fp)
+	if err != nil {
+		return nil, err
+	}
+	if encoding == EncodingUTF8 {
+		reader := bufio.NewReader(fp)
+		if b, _ := reader.Peek(len(utf8Bom)); bytes.Equal(b, utf8Bom) {
+			reader.Discard(len(utf8Bom))
+		}
+		return reader, nil
+	}
+	b, err := ioutil.ReadAll(fp)
+	if err != nil {
+		return nil, err
+	}
+	line, lineStart := 1, 0
+	var warnErr error
+	decoded := decodeText(b, encoding, func(offset int, size int) {
+		if warnErr != nil {
+			return
+		}
+		line += bytes.Count(b[lineStart:offset], []byte{'\n'})
+		lineStart = offset
+		warnErr = options.warn(line, WarningUndecodableSequence, fmt.Sprintf("%x", b[offset:offset+size]))
+	})
+	if warnErr != nil {
+		return nil, warnErr
+	}
+	return bytes.NewReader(decoded), nil
+}
@@ -0,0 +1,110 @@
+package migemo_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	testcases := []struct {
+		name     string
+		text     string
+		encoding migemo.Encoding
+		expected map[string]string
+	}{
+		{
+			"EUC-JP",
+			"\xa4\xab\xa4\xf3\xa4\xb8\t\xb4\xc1\xbb\xfa\n\xa4\xca\xa4\xdf\t\xa1\xc1\n\xa4\xcf\xa4\xf3\xa4\xab\xa4\xaf\t\x8e\xb6\x8e\xc5\n",
+			migemo.EncodingEUCJP,
+			map[string]string{"かんじ": "漢字", "なみ": "〜", "はんかく": "ｶﾅ"},
+		},
+		{
+			"Shift_JIS",
+			"\x82\xa9\x82\xf1\x82\xb6\t\x8a\xbf\x8e\x9a\n\x82\xc8\x82\xdd\t\x81`\n\x82\xdc\x82\xe9\t\x87@\n\x82\xcd\x82\xf1\x82\xa9\x82\xad\t\xb6\xc5\n",
+			migemo.EncodingShiftJIS,
+			map[string]string{"かんじ": "漢字", "なみ": "～", "まる": "①", "はんかく": "ｶﾅ"},
+		},
+		{
+			"UTF-8 with BOM",
+			"\xef\xbb\xbfかんじ\t漢字\n",
+			migemo.EncodingUTF8,
+			map[string]string{"かんじ": "漢字"},
+		},
+	}
+	for _, tc := range testcases {
+		if actual := migemo.DetectEncoding([]byte(tc.text)); actual != tc.encoding {
+			t.Errorf("%s: detected:%s", tc.name, actual)
+		}
+		for _, encoding := range []migemo.Encoding{migemo.EncodingAuto, tc.encoding} {
+			options := &migemo.BuildOptions{Strict: true, Encoding: encoding}
+			dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(tc.text), options)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			for key, word := range tc.expected {
+				if actual := strings.Join(collectWords(dict.Search, key), " "); actual != word {
+					t.Errorf("%s(%s): key:%s expected:%q actual:%q", tc.name, encoding, key, word, actual)
+				}
+			}
+		}
+	}
+}
+
+func TestDecode_UndecodableSequence(t *testing.T) {
+	testcases := []struct {
+		name     string
+		text     string
+		encoding migemo.Encoding
+		expected []migemo.BuildWarning
+	}{
+		{
+			"EUC-JP",
+			// 補助漢字、13区の文字、不正なバイト
+			"\xa4\xab\xa4\xf3\xa4\xb8\t\xb4\xc1\xbb\xfa\n\xa4\xdb\t\x8f\xb0\xa1\n\xa4\xde\xa4\xeb\t\xad\xa1\n\xa4\xa2\t\xff\n",
+			migemo.EncodingEUCJP,
+			[]migemo.BuildWarning{
+				{Line: 2, Kind: migemo.WarningUndecodableSequence, Key: "8fb0a1"},
+				{Line: 3, Kind: migemo.WarningUndecodableSequence, Key: "ada1"},
+				{Line: 4, Kind: migemo.WarningUndecodableSequence, Key: "ff"},
+			},
+		},
+		{
+			"Shift_JIS",
+			// 割り当てのない9区の文字、不正なバイト
+			"\x82\xa9\x82\xf1\x82\xb6\t\x8a\xbf\x8e\x9a\n\x82\xa0\t\x85\x40\n\x82\xa2\t\x80\n",
+			migemo.EncodingShiftJIS,
+			[]migemo.BuildWarning{
+				{Line: 2, Kind: migemo.WarningUndecodableSequence, Key: "8540"},
+				{Line: 3, Kind: migemo.WarningUndecodableSequence, Key: "80"},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		options := &migemo.BuildOptions{Encoding: tc.encoding}
+		dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(tc.text), options)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if actual := strings.Join(collectWords(dict.Search, "かんじ"), " "); actual != "漢字" {
+			t.Errorf("%s: expected:漢字 actual:%q", tc.name, actual)
+		}
+		if len(options.Warnings) != len(tc.expected) {
+			t.Fatalf("%s: expected:%v actual:%v", tc.name, tc.expected, options.Warnings)
+		}
+		for i, w := range tc.expected {
+			if options.Warnings[i] != w {
+				t.Errorf("%s: expected:%v actual:%v", tc.name, w, options.Warnings[i])
+			}
+		}
+		strict := &migemo.BuildOptions{Encoding: tc.encoding, Strict: true}
+		if _, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(tc.text), strict); !errors.Is(err, migemo.ErrBuildWarning) {
+			t.Errorf("%s: strict mode must fail: %v", tc.name, err)
+		}
+		if _, err := migemo.ReadSkkJisyo(strings.NewReader(tc.text), strict); !errors.Is(err, migemo.ErrBuildWarning) {
+			t.Errorf("%s: strict mode must fail in SKK-JISYO: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package migemo
+
+// SelectWithoutHints は、ベンチマークでSelectの索引の有無を比較するために公開する
+func (bitVector *BitVector) SelectWithoutHints(count uint32, b bool) uint {
+	return bitVector.selectWithoutHints(count, b)
+}
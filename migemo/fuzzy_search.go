@@ -0,0 +1,134 @@
+package migemo
+
+// fuzzyMatcher は、トライをたどりながら、キーとの編集距離(レーベンシュタイン距離)を動的計画法で求める。
+// rows[d]は、深さdまでの文字列とキーの各接頭辞との編集距離
+type fuzzyMatcher struct {
+	key         []uint16
+	maxDistance int
+	rows        [][]int
+}
+
+func newFuzzyMatcher(key []uint16, maxDistance int) *fuzzyMatcher {
+	row := make([]int, len(key)+1)
+	for i := range row {
+		row[i] = i
+	}
+	return &fuzzyMatcher{
+		key:         key,
+		maxDistance: maxDistance,
+		rows:        [][]int{row},
+	}
+}
+
+// push は、深さdepthまでの文字列に文字cを追加したときの編集距離を求める。
+// さらに文字を追加して編集距離がmaxDistance以下になりうるならtrue
+func (matcher *fuzzyMatcher) push(depth int, c uint16) bool {
+	n := len(matcher.key)
+	for len(matcher.rows) <= depth+1 {
+		matcher.rows = append(matcher.rows, make([]int, n+1))
+	}
+	prev := matcher.rows[depth]
+	row := matcher.rows[depth+1]
+	row[0] = prev[0] + 1
+	min := row[0]
+	for i := 1; i <= n; i++ {
+		cost := 1
+		if matcher.key[i-1] == c {
+			cost = 0
+		}
+		d := prev[i-1] + cost
+		if prev[i]+1 < d {
+			d = prev[i] + 1
+		}
+		if row[i-1]+1 < d {
+			d = row[i-1] + 1
+		}
+		row[i] = d
+		if d < min {
+			min = d
+		}
+	}
+	return min <= matcher.maxDistance
+}
+
+func (matcher *fuzzyMatcher) accepts(depth int) bool {
+	return matcher.distance(depth) <= matcher.maxDistance
+}
+
+// distance は、深さdepthまでの文字列とキー全体との編集距離を返す
+func (matcher *fuzzyMatcher) distance(depth int) int {
+	return matcher.rows[depth][len(matcher.key)]
+}
+
+// fuzzySearch は、trieのキーのうち、keyとの編集距離がmaxDistance以下のもののノード番号と編集距離を関数fに返す
+func fuzzySearch(walk func(node int, automaton trieAutomaton, depth int, f func(node int, depth int)), key []uint16, maxDistance int, f func(node int, distance int)) {
+	matcher := newFuzzyMatcher(key, maxDistance)
+	walk(1, matcher, 0, func(node int, depth int) {
+		f(node, matcher.distance(depth))
+	})
+}
+
+// FuzzySearch は、keyとの編集距離がmaxDistance以下の全てのキーについて、そのノード番号と編集距離をキーの辞書順に関数fに返す。根は含めない
+func (trie *LoudsTrieU16) FuzzySearch(key []uint16, maxDistance int, f func(node int, distance int)) {
+	fuzzySearch(trie.walkAutomaton, key, maxDistance, f)
+}
+
+// FuzzySearch は、keyとの編集距離がmaxDistance以下の全てのキーについて、そのノード番号と編集距離をキーの辞書順に関数fに返す。根は含めない
+func (trie *LoudsDoubleTrie) FuzzySearch(key []uint16, maxDistance int, f func(node int, distance int)) {
+	fuzzySearch(trie.walkAutomaton, key, maxDistance, f)
+}
+
+// FuzzySearch は、keyとの編集距離がmaxDistance以下の全てのキーについて、そのノード番号と編集距離をキーの辞書順に関数fに返す。根は含めない
+func (trie *LoudsPrefixTrie) FuzzySearch(key []uint16, maxDistance int, f func(node int, distance int)) {
+	fuzzySearch(trie.walkAutomaton, key, maxDistance, f)
+}
+
+// FuzzySearch は、keyとの編集距離がmaxDistance以下の全てのキーについて、そのノード番号と編集距離をキーの辞書順に関数fに返す。根は含めない
+func (trie *LoudsPatriciaTrie) FuzzySearch(key []uint16, maxDistance int, f func(node int, distance int)) {
+	fuzzySearch(trie.walkAutomaton, key, maxDistance, f)
+}
+
+// FuzzySearch は、UTF-8のバイトを文字にまとめてから、UTF-16での編集距離を求める
+func (adapter *loudsTrieU8Adapter) FuzzySearch(key []uint16, maxDistance int, f func(node int, distance int)) {
+	fuzzySearch(adapter.walkAutomaton, key, maxDistance, f)
+}
+
+// FuzzySearch は、keyとの編集距離がmaxDistance以下の全ての読みについて、読みと単語、単語の重み、編集距離を、
+// 読みの辞書順にコールバック関数fに返す。重みを持たない辞書では、重みは全て0になる
+func (compactDictionary *CompactDictionary) FuzzySearch(key []uint16, maxDistance int, f func(key []uint16, word []uint16, weight uint8, distance int)) {
+	compactDictionary.FuzzySearchBounded(key, maxDistance, 0, f)
+}
+
+// FuzzySearchBounded は、FuzzySearchと同じ順に読みと単語、単語の重み、編集距離をコールバック関数fに返す。
+// maxNodesが正なら、キーのトライで巡る文字数をmaxNodesまでに制限する。
+// 巡った文字数と、制限に達して検索を打ち切ったかを返す
+func (compactDictionary *CompactDictionary) FuzzySearchBounded(key []uint16, maxDistance int, maxNodes int, f func(key []uint16, word []uint16, weight uint8, distance int)) (int, bool) {
+	if compactDictionary == nil {
+		return 0, false
+	}
+	matcher := newFuzzyMatcher(key, maxDistance)
+	automaton := &boundedAutomaton{trieAutomaton: matcher, maxNodes: maxNodes}
+	compactDictionary.keyTrie.walkAutomaton(1, automaton, 0, func(node int, depth int) {
+		distance := matcher.distance(depth)
+		compactDictionary.searchNodeWords(node, func(key []uint16, word []uint16, weight uint8) {
+			f(key, word, weight, distance)
+		})
+	})
+	return automaton.visited, automaton.truncated
+}
+
+// searchNodeWords は、キーのノードnodeに対応する読みと単語、単語の重みをコールバック関数fに返す
+func (compactDictionary *CompactDictionary) searchNodeWords(node int, f func(key []uint16, word []uint16, weight uint8)) {
+	if !compactDictionary.hasMappingBitList.Get(node) {
+		return
+	}
+	key := make([]uint16, 0, 16)
+	compactDictionary.keyTrie.ReverseLookup(uint32(node), &key)
+	word := make([]uint16, 0, 16)
+	start, end := compactDictionary.mappingRange(node)
+	for j := start; j < end; j++ {
+		word = word[:0]
+		compactDictionary.valueTrie.ReverseLookup(compactDictionary.mapping[j], &word)
+		f(key, word, compactDictionary.weight(j))
+	}
+}
@@ -0,0 +1,96 @@
+package migemo_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func editDistance(a []uint16, b []uint16) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			d := prev
+			if a[i-1] != b[j-1] {
+				d++
+			}
+			if row[j]+1 < d {
+				d = row[j] + 1
+			}
+			if row[j-1]+1 < d {
+				d = row[j-1] + 1
+			}
+			prev, row[j] = row[j], d
+		}
+	}
+	return row[len(b)]
+}
+
+func TestTrie_FuzzySearch(t *testing.T) {
+	words := []string{"きょう", "けんさく", "けんさくする", "けんしゅう", "けんすう", "さくら", "とうきょう", "とうきょうと", "ぶんしょう", "\U0001F363"}
+	sort.Strings(words)
+	keys := make([][]uint16, len(words))
+	isKey := make(map[string]bool)
+	for i, w := range words {
+		keys[i] = utf16.Encode([]rune(w))
+		isKey[w] = true
+	}
+	u8, _ := migemo.BuildLoudsTrieU8(words)
+	tries := map[string]migemo.Trie{"u8": u8.AsTrie()}
+	for _, trieType := range []migemo.TrieType{migemo.TrieTypeLouds, migemo.TrieTypeDouble, migemo.TrieTypePrefix, migemo.TrieTypePatricia} {
+		trie, err := migemo.BuildTrie(trieType, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tries[trieType.String()] = trie
+	}
+	queries := []string{"けんすく", "けんさく", "とうきょ", "きょう", "", "\U0001F364"}
+	for name, trie := range tries {
+		for _, query := range queries {
+			q := utf16.Encode([]rune(query))
+			for k := 0; k <= 2; k++ {
+				expected := make([]string, 0)
+				for i, key := range keys {
+					if d := editDistance(q, key); d <= k {
+						expected = append(expected, words[i]+":"+string(rune('0'+d)))
+					}
+				}
+				actual := make([]string, 0)
+				trie.FuzzySearch(q, k, func(node int, distance int) {
+					key := make([]uint16, 0)
+					trie.ReverseLookup(uint32(node), &key)
+					// 内部ノードも返るので、キーだけを比較する
+					if s := string(utf16.Decode(key)); isKey[s] {
+						actual = append(actual, s+":"+string(rune('0'+distance)))
+					}
+				})
+				sort.Strings(expected)
+				sort.Strings(actual)
+				if strings.Join(expected, ",") != strings.Join(actual, ",") {
+					t.Errorf("%s %q k=%d expected:%v actual:%v", name, query, k, expected, actual)
+				}
+			}
+		}
+	}
+}
+
+func TestCompactDictionary_FuzzySearch(t *testing.T) {
+	dict := LoadCompactDictionary()
+	found := false
+	dict.FuzzySearch(utf16.Encode([]rune("けんすく")), 1, func(key []uint16, word []uint16, weight uint8, distance int) {
+		if string(utf16.Decode(key)) == "けんさく" && string(utf16.Decode(word)) == "検索" {
+			found = found || distance == 1
+		}
+	})
+	if !found {
+		t.Error("検索 is not found")
+	}
+}
@@ -0,0 +1,187 @@
+package migemo
+
+import (
+	"math"
+	"unicode/utf16"
+)
+
+// DictionaryLayer は、LayeredDictionaryにおいてシステム辞書の上に重ねる辞書
+type DictionaryLayer struct {
+	Dictionary Dictionary
+	// Suppress は、このレイヤーによってシステム辞書から隠す単語。
+	// キーは読み、値はその読みで隠す単語の一覧で、一覧が空ならその読みの単語を全て隠す
+	Suppress map[string][]string
+}
+
+// LayeredDictionary は、システム辞書の上にユーザー辞書を重ね、まとめて検索する辞書
+type LayeredDictionary struct {
+	system *CompactDictionary
+	layers []DictionaryLayer
+	// suppressed は、全てのレイヤーのSuppressをまとめたもの。値がnilなら読みの単語を全て隠す
+	suppressed map[string]map[string]struct{}
+}
+
+// NewLayeredDictionary は、システム辞書systemにlayersを重ねたLayeredDictionaryを生成する
+func NewLayeredDictionary(system *CompactDictionary, layers ...DictionaryLayer) *LayeredDictionary {
+	dict := &LayeredDictionary{
+		system:     system,
+		suppressed: make(map[string]map[string]struct{}),
+	}
+	for _, layer := range layers {
+		dict.AddLayer(layer)
+	}
+	return dict
+}
+
+// AddLayer は、レイヤーを最も上に追加する
+func (dict *LayeredDictionary) AddLayer(layer DictionaryLayer) {
+	dict.layers = append(dict.layers, layer)
+	for key, words := range layer.Suppress {
+		set, ok := dict.suppressed[key]
+		if ok && set == nil {
+			continue
+		}
+		if len(words) == 0 {
+			dict.suppressed[key] = nil
+			continue
+		}
+		if !ok {
+			set = make(map[string]struct{}, len(words))
+			dict.suppressed[key] = set
+		}
+		for _, w := range words {
+			set[w] = struct{}{}
+		}
+	}
+}
+
+func (dict *LayeredDictionary) isSuppressed(key []uint16, word []uint16) bool {
+	set, ok := dict.suppressed[string(utf16.Decode(key))]
+	if !ok {
+		return false
+	}
+	if set == nil {
+		return true
+	}
+	_, ok = set[string(utf16.Decode(word))]
+	return ok
+}
+
+// Search は、キーに一致する単語を、上のレイヤーから順にコールバック関数fに返す
+func (dict *LayeredDictionary) Search(key []uint16, f func([]uint16)) {
+	for i := len(dict.layers) - 1; i >= 0; i-- {
+		dict.layers[i].Dictionary.Search(key, f)
+	}
+	if dict.system == nil {
+		return
+	}
+	if len(dict.suppressed) == 0 {
+		dict.system.Search(key, f)
+		return
+	}
+	dict.system.Search(key, func(word []uint16) {
+		if !dict.isSuppressed(key, word) {
+			f(word)
+		}
+	})
+}
+
+// PredictiveSearch は、接頭辞がkeyに一致する全ての単語を、上のレイヤーから順にコールバック関数fに返す
+func (dict *LayeredDictionary) PredictiveSearch(key []uint16, f func([]uint16)) {
+	for i := len(dict.layers) - 1; i >= 0; i-- {
+		dict.layers[i].Dictionary.PredictiveSearch(key, f)
+	}
+	if dict.system == nil {
+		return
+	}
+	if len(dict.suppressed) == 0 {
+		dict.system.PredictiveSearch(key, f)
+		return
+	}
+	dict.system.predictiveSearch(key, true, 0, func(key []uint16, word []uint16, weight uint8) {
+		if !dict.isSuppressed(key, word) {
+			f(word)
+		}
+	})
+}
+
+// HasWeights は、システム辞書かいずれかのレイヤーが単語の重みを持つかを返す
+func (dict *LayeredDictionary) HasWeights() bool {
+	if dict.system != nil && dict.system.HasWeights() {
+		return true
+	}
+	for _, layer := range dict.layers {
+		if weighted, ok := layer.Dictionary.(WeightedDictionary); ok && weighted.HasWeights() {
+			return true
+		}
+	}
+	return false
+}
+
+// PredictiveSearchWeighted は、接頭辞がkeyに一致する全ての単語を、その重みとともに上のレイヤーから順にコールバック関数fに返す。
+// ユーザーが登録した単語が絞り込みで除かれないよう、重みを持たないレイヤーの単語の重みは最大値とする
+func (dict *LayeredDictionary) PredictiveSearchWeighted(key []uint16, f func(word []uint16, weight uint8)) {
+	dict.PredictiveSearchBounded(key, 0, f)
+}
+
+// PredictiveSearchBounded は、PredictiveSearchWeightedと同じ順に単語とその重みをコールバック関数fに返す。
+// maxNodesが正なら、システム辞書で巡るキーのノード数をmaxNodesまでに制限する。レイヤーの検索は制限しない。
+// システム辞書で巡ったノード数と、制限に達して検索を打ち切ったかを返す
+func (dict *LayeredDictionary) PredictiveSearchBounded(key []uint16, maxNodes int, f func(word []uint16, weight uint8)) (int, bool) {
+	for i := len(dict.layers) - 1; i >= 0; i-- {
+		if weighted, ok := dict.layers[i].Dictionary.(WeightedDictionary); ok && weighted.HasWeights() {
+			weighted.PredictiveSearchWeighted(key, f)
+			continue
+		}
+		dict.layers[i].Dictionary.PredictiveSearch(key, func(word []uint16) {
+			f(word, math.MaxUint8)
+		})
+	}
+	if dict.system == nil {
+		return 0, false
+	}
+	if len(dict.suppressed) == 0 {
+		return dict.system.PredictiveSearchBounded(key, maxNodes, f)
+	}
+	return dict.system.predictiveSearch(key, true, maxNodes, func(key []uint16, word []uint16, weight uint8) {
+		if !dict.isSuppressed(key, word) {
+			f(word, weight)
+		}
+	})
+}
+
+// FuzzySearch は、keyとの編集距離がmaxDistance以下の読みの単語を、上のレイヤーから順にコールバック関数fに返す。
+// FuzzyDictionaryを実装しないレイヤーは検索しない。重みを持たないレイヤーの単語の重みは最大値とする
+func (dict *LayeredDictionary) FuzzySearch(key []uint16, maxDistance int, f func(key []uint16, word []uint16, weight uint8, distance int)) {
+	dict.FuzzySearchBounded(key, maxDistance, 0, f)
+}
+
+// FuzzySearchBounded は、FuzzySearchと同じ順に読みと単語、単語の重み、編集距離をコールバック関数fに返す。
+// maxNodesが正なら、システム辞書で巡るノード数をmaxNodesまでに制限する。レイヤーの検索は制限しない。
+// システム辞書で巡ったノード数と、制限に達して検索を打ち切ったかを返す
+func (dict *LayeredDictionary) FuzzySearchBounded(key []uint16, maxDistance int, maxNodes int, f func(key []uint16, word []uint16, weight uint8, distance int)) (int, bool) {
+	for i := len(dict.layers) - 1; i >= 0; i-- {
+		fuzzy, ok := dict.layers[i].Dictionary.(FuzzyDictionary)
+		if !ok {
+			continue
+		}
+		if weighted, ok := fuzzy.(WeightedDictionary); ok && weighted.HasWeights() {
+			fuzzy.FuzzySearch(key, maxDistance, f)
+			continue
+		}
+		fuzzy.FuzzySearch(key, maxDistance, func(key []uint16, word []uint16, _ uint8, distance int) {
+			f(key, word, math.MaxUint8, distance)
+		})
+	}
+	if dict.system == nil {
+		return 0, false
+	}
+	if len(dict.suppressed) == 0 {
+		return dict.system.FuzzySearchBounded(key, maxDistance, maxNodes, f)
+	}
+	return dict.system.FuzzySearchBounded(key, maxDistance, maxNodes, func(key []uint16, word []uint16, weight uint8, distance int) {
+		if !dict.isSuppressed(key, word) {
+			f(key, word, weight, distance)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package migemo_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func buildDictionary(t *testing.T, text string) *migemo.CompactDictionary {
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dict
+}
+
+func collectWords(search func([]uint16, func([]uint16)), key string) []string {
+	list := []string{}
+	search(utf16.Encode([]rune(key)), func(s []uint16) {
+		list = append(list, string(utf16.Decode(s)))
+	})
+	sort.Strings(list)
+	return list
+}
+
+func TestLayeredDictionary(t *testing.T) {
+	system := buildDictionary(t, "かんじ\t漢字\t幹事\t感じ\nかんじょう\t感情\t勘定\nかんさい\t関西\n")
+	user := buildDictionary(t, "かんじ\t監事\nかんと\tカント\n")
+	dict := migemo.NewLayeredDictionary(system, migemo.DictionaryLayer{
+		Dictionary: user,
+		Suppress: map[string][]string{
+			"かんじ":   {"幹事"},
+			"かんじょう": nil,
+		},
+	})
+
+	testcases := []struct {
+		search func([]uint16, func([]uint16))
+		key    string
+		expect string
+	}{
+		{dict.Search, "かんじ", "感じ 漢字 監事"},
+		{dict.Search, "かんじょう", ""},
+		{dict.Search, "かんと", "カント"},
+		{dict.PredictiveSearch, "かんじ", "感じ 漢字 監事"},
+		{dict.PredictiveSearch, "かん", "カント 感じ 漢字 監事 関西"},
+		{dict.PredictiveSearch, "さ", ""},
+	}
+	for _, tc := range testcases {
+		actual := strings.Join(collectWords(tc.search, tc.key), " ")
+		if actual != tc.expect {
+			t.Errorf("key:%s expected:%q actual:%q", tc.key, tc.expect, actual)
+		}
+	}
+
+	operator := migemo.NewRegexOperator("|", "(", ")", "[", "]", "")
+	if re := migemo.Query("kanji", dict, operator); !strings.Contains(re, "監事") || strings.Contains(re, "幹事") {
+		t.Errorf("invalid query result: %s", re)
+	}
+}
+
+func TestLayeredDictionary_FuzzySearch(t *testing.T) {
+	system := buildDictionary(t, "かんじ\t漢字\t幹事\nかんじょう\t感情\n")
+	user := buildDictionary(t, "かんし\t監視\n")
+	dict := migemo.NewLayeredDictionary(system, migemo.DictionaryLayer{
+		Dictionary: user,
+		Suppress:   map[string][]string{"かんじ": {"幹事"}},
+	})
+	actual := []string{}
+	dict.FuzzySearch(utf16.Encode([]rune("かんぢ")), 1, func(key []uint16, word []uint16, weight uint8, distance int) {
+		actual = append(actual, string(utf16.Decode(word)))
+	})
+	if strings.Join(actual, ",") != "監視,漢字" {
+		t.Errorf("expected:[監視 漢字] actual:%v", actual)
+	}
+	operator := migemo.NewRegexOperator("|", "(", ")", "[", "]", "")
+	if result := migemo.QueryWithOptions("kandi", dict, operator, &migemo.QueryOptions{FuzzyDistance: 1}); !strings.Contains(result.Pattern, "漢字") {
+		t.Errorf("漢字 is not found: %s", result.Pattern)
+	}
+}
@@ -2,7 +2,6 @@ package migemo
 
 import (
 	"sort"
-	"unicode/utf16"
 )
 
 // LoudsDoubleTrie は、あるノード以降において分岐がない場合、
@@ -50,6 +49,31 @@ func (trie *LoudsDoubleTrie) Lookup(key []uint16) int {
 	return -1
 }
 
+// CommonPrefixSearch は、keyの接頭辞になっている全てのキーについて、その長さとノード番号を短い順に関数fに返す。
+// 根と、Tailの途中で終わる接頭辞は含めない
+func (trie *LoudsDoubleTrie) CommonPrefixSearch(key []uint16, f func(keyLen int, node int)) {
+	node := 1
+	for i := 0; i < len(key); i++ {
+		node = trie.prefixTrie.Traverse(uint32(node), key[i])
+		if node == -1 {
+			return
+		}
+		if trie.linkBitVector.Get(uint32(node)) {
+			// Tail全体がkeyに含まれていれば、そのキーは接頭辞になっている
+			tailNode := trie.linkArray[trie.linkBitVector.Rank(uint(node), true)]
+			for i++; tailNode > 1; i++ {
+				if len(key) <= i || key[i] != trie.tailTrie.edges[tailNode] {
+					return
+				}
+				tailNode = trie.tailTrie.Parent(tailNode)
+			}
+			f(i, node)
+			return
+		}
+		f(i+1, node)
+	}
+}
+
 // ReverseLookup は、指定されたノード番号からキーを復元する
 func (trie *LoudsDoubleTrie) ReverseLookup(index uint32, key *[]uint16) int {
 	prefixLength := trie.prefixTrie.ReverseLookup(index, key)
@@ -71,30 +95,46 @@ func (trie *LoudsDoubleTrie) PredictiveSearchBreadthFirst(node int, f func(int))
 	trie.prefixTrie.PredictiveSearchBreadthFirst(node, f)
 }
 
+// PredictiveSearchOrdered は、指定したノードから葉の方向に全てのノードを、キーの辞書順に巡る。
+// fがfalseを返したら打ち切り、trueを返す
+func (trie *LoudsDoubleTrie) PredictiveSearchOrdered(node int, f func(int) bool) bool {
+	return trie.prefixTrie.PredictiveSearchOrdered(node, f)
+}
+
+// predictiveSearchBreadthFirstUntil は、PredictiveSearchBreadthFirstと同じ順にノードを巡り、fがfalseを返したら打ち切る
+func (trie *LoudsDoubleTrie) predictiveSearchBreadthFirstUntil(node int, f func(int) bool) bool {
+	return trie.prefixTrie.predictiveSearchBreadthFirstUntil(node, f)
+}
+
 // BuildLoudsDoubleTrie は、ソート済みのkeysからトライを作成する
 func BuildLoudsDoubleTrie(keys [][]uint16) (*LoudsDoubleTrie, []uint32) {
 	numOfTailWord := 0
 	// TAIL文字列を抽出
 	tailList := ExtractTailU16Strings(keys)
-	tailStrings := make(map[string]struct{})
+	// サロゲートペアの途中で分割されることもあるため、UTF-16のまま重複を取り除く
+	tailStringList := make([][]uint16, 0)
 	for i := 0; i < len(tailList); i++ {
 		if tailList[i] > 0 {
 			numOfTailWord++
 			s := keys[i]
-			tail := s[len(s)-int(tailList[i]):]
-			tailStrings[string(utf16.Decode(tail))] = struct{}{}
-		}
-	}
-	tailStringList := make([][]uint16, 0)
-	for k := range tailStrings {
-		s := utf16.Encode([]rune(k))
-		for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
-			s[i], s[j] = s[j], s[i]
+			tail := make([]uint16, tailList[i])
+			copy(tail, s[len(s)-int(tailList[i]):])
+			for i, j := 0, len(tail)-1; i < j; i, j = i+1, j-1 {
+				tail[i], tail[j] = tail[j], tail[i]
+			}
+			tailStringList = append(tailStringList, tail)
 		}
-		tailStringList = append(tailStringList, s)
 	}
 	// Tailトライを作成
 	sort.Slice(tailStringList, func(i, j int) bool { return CompareUtf16String(tailStringList[i], tailStringList[j]) < 0 })
+	uniqueTailCount := 0
+	for i := 0; i < len(tailStringList); i++ {
+		if i == 0 || CompareUtf16String(tailStringList[i-1], tailStringList[i]) != 0 {
+			tailStringList[uniqueTailCount] = tailStringList[i]
+			uniqueTailCount++
+		}
+	}
+	tailStringList = tailStringList[:uniqueTailCount]
 	tailTrie, _ := BuildLoudsTrie(tailStringList)
 	// Prefixトライを作成
 	prefixStringList := make([][]uint16, len(keys))
@@ -2,11 +2,11 @@ package migemo
 
 // LoudsPatriciaTrie is ...
 type LoudsPatriciaTrie struct {
-	trie      *LoudsTrieU16
-	outs      *BitVector
-	links     *BitVector
-	tailBits  *BitVector
-	tailChars []uint16
+	trie  *LoudsTrieU16
+	outs  *BitVector
+	links *BitVector
+	// tail は、一人っ子の続くノードの文字列を、リンクを持つノードの順に格納する
+	tail *Tail
 }
 
 // Lookup is ...
@@ -20,34 +20,48 @@ func (trie *LoudsPatriciaTrie) Lookup(key []uint16) int {
 			return -1
 		}
 		// パトリシアなら、tail配列で一致するか判定
+		cursor++
 		if trie.links.Get(uint32(node)) {
-			tail := trie.GetTail(node)
-			cursor++
-			for i := 0; i < len(tail); i++ {
-				if cursor == len(key) {
-					return -node
-				}
-				if key[cursor] != tail[i] {
-					return -1
-				}
-				cursor++
-			}
-			if len(key) == cursor {
-				return node
-			} else if len(key) < cursor {
+			n, match := trie.tail.Match(int(trie.links.Rank(uint(node), true)), key[cursor:])
+			switch match {
+			case TailPartial:
 				return -node
+			case TailMismatch:
+				return -1
 			}
-			cursor--
+			cursor += n
 		}
-		cursor++
 	}
 	return node
 }
 
+// CommonPrefixSearch は、keyの接頭辞になっている全てのキーについて、その長さとノード番号を短い順に関数fに返す。
+// 根と、TAILの途中で終わる接頭辞は含めない
+func (trie *LoudsPatriciaTrie) CommonPrefixSearch(key []uint16, f func(keyLen int, node int)) {
+	node := 1
+	cursor := 0
+	for cursor < len(key) {
+		node = trie.trie.Traverse(uint32(node), key[cursor])
+		if node == -1 {
+			return
+		}
+		cursor++
+		if trie.links.Get(uint32(node)) {
+			n, match := trie.tail.Match(int(trie.links.Rank(uint(node), true)), key[cursor:])
+			if match != TailMatched {
+				return
+			}
+			cursor += n
+		}
+		f(cursor, node)
+	}
+}
+
 // ReverseLookup is ...
 func (trie *LoudsPatriciaTrie) ReverseLookup(node uint32, key *[]uint16) int {
 	offset := len(*key)
-	for node > 1 {
+	// 壊れたトライで親をたどり続けないよう、深さをノードの個数までに制限する
+	for depth, size := 0, trie.Size(); node > 1 && depth < size; depth++ {
 		// ノードがパトリシアであればtail文字列を追加
 		if trie.links.Get(uint32(node)) {
 			tail := trie.GetTail(int(node))
@@ -66,30 +80,28 @@ func (trie *LoudsPatriciaTrie) ReverseLookup(node uint32, key *[]uint16) int {
 	return len(*key) - offset
 }
 
-// GetTail is ...
+// GetTail は、ノードnodeに続くTAILを返す。TAILへのリンクを持たなければnil
 func (trie *LoudsPatriciaTrie) GetTail(node int) []uint16 {
 	if trie.links.Get(uint32(node)) {
-		tailIndex := trie.links.Rank(uint(node), true) + 1
-		tailStart := trie.tailBits.Select(uint32(tailIndex), false)
-		tailEnd := trie.tailBits.NextClearBit(tailStart+1) - 1
-		tailSize := tailEnd - tailStart
-		tailOffset := trie.tailBits.Rank(tailStart, true)
-		return trie.tailChars[tailOffset : tailOffset+tailSize]
+		return trie.tail.Get(int(trie.links.Rank(uint(node), true)))
 	}
 	return nil
 }
 
-// PredictiveSearchBreadthFirst is ...
+// PredictiveSearchBreadthFirst は、指定したノードから葉の方向に全てのノードを幅優先で巡る
 func (trie *LoudsPatriciaTrie) PredictiveSearchBreadthFirst(node int, f func(int)) {
-	lower := uint(node)
-	upper := uint(node + 1)
-	for upper-lower > 0 {
-		for i := lower; i < upper; i++ {
-			f(int(i))
-		}
-		lower = trie.trie.bitVector.Rank(trie.trie.bitVector.Select(uint32(lower), false)+1, true) + 1
-		upper = trie.trie.bitVector.Rank(trie.trie.bitVector.Select(uint32(upper), false)+1, true) + 1
-	}
+	trie.trie.PredictiveSearchBreadthFirst(node, f)
+}
+
+// PredictiveSearchOrdered は、指定したノードから葉の方向に全てのノードを、キーの辞書順に巡る。
+// fがfalseを返したら打ち切り、trueを返す
+func (trie *LoudsPatriciaTrie) PredictiveSearchOrdered(node int, f func(int) bool) bool {
+	return trie.trie.PredictiveSearchOrdered(node, f)
+}
+
+// predictiveSearchBreadthFirstUntil は、PredictiveSearchBreadthFirstと同じ順にノードを巡り、fがfalseを返したら打ち切る
+func (trie *LoudsPatriciaTrie) predictiveSearchBreadthFirstUntil(node int, f func(int) bool) bool {
+	return trie.trie.predictiveSearchBreadthFirstUntil(node, f)
 }
 
 // BuildLoudsPatriciaTrie is ...
@@ -105,10 +117,9 @@ func BuildLoudsPatriciaTrie(keys [][]uint16) (*LoudsPatriciaTrie, *BitList) {
 	labels[0] = ' '
 	nodes := make([]int, 1)
 	nodes[0] = 1
-	tailBits := NewBitList()
+	tails := make([][]uint16, 0)
 	links := NewBitList()
 	links.Add(false)
-	tailChars := make([]uint16, 0)
 	outs := NewBitList()
 	outs.Add(false)
 	level := 0
@@ -123,17 +134,17 @@ func BuildLoudsPatriciaTrie(keys [][]uint16) (*LoudsPatriciaTrie, *BitList) {
 			if level > 0 && trie.bitVector.Get(uint32(pos)+1) == true && trie.bitVector.Get(uint32(pos)+2) == false && !oldOutBits.Get(node) {
 				// 子が1つだけなのでパトリシア
 				links.Add(true)
-				tailBits.Add(false)
+				tail := make([]uint16, 0)
 				for true {
 					// キーでない一人っ子が続く限り、子孫をたどる
 					node = int(trie.bitVector.Rank(pos+1, true)) + 1
 					pos = trie.bitVector.Select(uint32(node), false)
-					tailChars = append(tailChars, trie.edges[node])
-					tailBits.Add(true)
+					tail = append(tail, trie.edges[node])
 					if uint(trie.bitVector.sizeInBits) <= pos+2 || trie.bitVector.Get(uint32(pos)+1) != true || trie.bitVector.Get(uint32(pos)+2) != false || oldOutBits.Get(node) {
 						break
 					}
 				}
+				tails = append(tails, tail)
 			} else {
 				links.Add(false)
 			}
@@ -154,11 +165,10 @@ func BuildLoudsPatriciaTrie(keys [][]uint16) (*LoudsPatriciaTrie, *BitList) {
 	}
 	newLoudsTrie := NewLoudsTrie(NewBitVector(louds.Words, uint32(louds.Size)), labels)
 	patriciaTrie := &LoudsPatriciaTrie{
-		trie:      newLoudsTrie,
-		outs:      NewBitVector(outs.Words, uint32(outs.Size)),
-		links:     NewBitVector(links.Words, uint32(links.Size)),
-		tailBits:  NewBitVector(tailBits.Words, uint32(tailBits.Size)),
-		tailChars: tailChars,
+		trie:  newLoudsTrie,
+		outs:  NewBitVector(outs.Words, uint32(outs.Size)),
+		links: NewBitVector(links.Words, uint32(links.Size)),
+		tail:  BuildTail(tails),
 	}
 	return patriciaTrie, outs
 }
@@ -168,7 +178,12 @@ func (trie *LoudsPatriciaTrie) Size() int {
 	return trie.trie.Size()
 }
 
+// NumOfNodes は、ノードの個数を返す。TAILの文字はノードに含めない
+func (trie *LoudsPatriciaTrie) NumOfNodes() int {
+	return trie.trie.Size()
+}
+
 // IoSize is ...
 func (trie *LoudsPatriciaTrie) IoSize() int {
-	return trie.trie.IoSize() + trie.outs.IoSize() + trie.links.IoSize() + trie.tailBits.IoSize() + IoSizeUint16Array(trie.tailChars)
+	return trie.trie.IoSize() + trie.outs.IoSize() + trie.links.IoSize() + trie.tail.IoSize()
 }
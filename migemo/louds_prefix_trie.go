@@ -9,10 +9,8 @@ type LoudsPrefixTrie struct {
 	outs *BitVector
 	// links は、そのノードがTAILへのリンクを持つのかを格納する
 	links *BitVector
-	// tailBits は、TAIL配列の区切りを格納する
-	tailBits *BitVector
-	// tailChars は、トライにおいて分岐のない文字列を格納するTAIL配列
-	tailChars []uint16
+	// tail は、トライにおいて分岐のない文字列を、リンクを持つノードの順に格納する
+	tail *Tail
 }
 
 // Lookup is ...
@@ -27,30 +25,40 @@ func (trie *LoudsPrefixTrie) Lookup(key []uint16) int {
 		}
 		if trie.links.Get(uint32(nodeIndex)) {
 			cursor++
-			tail := trie.GetTail(nodeIndex)
-			if len(key) > len(tail)+cursor {
+			n, match := trie.tail.Match(int(trie.links.Rank(uint(nodeIndex), true)), key[cursor:])
+			switch {
+			case match == TailPartial:
+				return -nodeIndex
+			case match == TailMismatch || cursor+n != len(key):
 				return -1
 			}
-			end := len(tail)
-			if len(key)-cursor < end {
-				end = len(key) - cursor
-			}
-			j := 0
-			for ; j < end; j++ {
-				if key[cursor+j] != tail[j] {
-					return -1
-				}
-			}
-			if len(tail) == j {
-				return nodeIndex
-			}
-			return -nodeIndex
+			return nodeIndex
 		}
 		cursor++
 	}
 	return nodeIndex
 }
 
+// CommonPrefixSearch は、keyの接頭辞になっている全てのキーについて、その長さとノード番号を短い順に関数fに返す。
+// 根と、TAILの途中で終わる接頭辞は含めない
+func (trie *LoudsPrefixTrie) CommonPrefixSearch(key []uint16, f func(keyLen int, node int)) {
+	node := 1
+	for i, c := range key {
+		node = trie.trie.Traverse(uint32(node), c)
+		if node == -1 {
+			return
+		}
+		if trie.links.Get(uint32(node)) {
+			n, match := trie.tail.Match(int(trie.links.Rank(uint(node), true)), key[i+1:])
+			if match == TailMatched {
+				f(i+1+n, node)
+			}
+			return
+		}
+		f(i+1, node)
+	}
+}
+
 // ReverseLookup は、指定されたノード番号からキーを復元する
 func (trie *LoudsPrefixTrie) ReverseLookup(index uint32, key *[]uint16) int {
 	prefixLength := trie.trie.ReverseLookup(index, key)
@@ -63,15 +71,10 @@ func (trie *LoudsPrefixTrie) ReverseLookup(index uint32, key *[]uint16) int {
 	return prefixLength
 }
 
-// GetTail is ...
+// GetTail は、ノードnodeに続くTAILを返す。TAILへのリンクを持たなければnil
 func (trie *LoudsPrefixTrie) GetTail(node int) []uint16 {
 	if trie.links.Get(uint32(node)) {
-		tailIndex := trie.links.Rank(uint(node), true) + 1
-		tailStart := trie.tailBits.Select(uint32(tailIndex), false)
-		tailEnd := trie.tailBits.NextClearBit(tailStart+1) - 1
-		tailSize := tailEnd - tailStart
-		tailOffset := trie.tailBits.Rank(tailStart, true)
-		return trie.tailChars[tailOffset : tailOffset+tailSize]
+		return trie.tail.Get(int(trie.links.Rank(uint(node), true)))
 	}
 	return nil
 }
@@ -81,6 +84,17 @@ func (trie *LoudsPrefixTrie) PredictiveSearchBreadthFirst(node int, f func(int))
 	trie.trie.PredictiveSearchBreadthFirst(node, f)
 }
 
+// PredictiveSearchOrdered は、指定したノードから葉の方向に全てのノードを、キーの辞書順に巡る。
+// fがfalseを返したら打ち切り、trueを返す
+func (trie *LoudsPrefixTrie) PredictiveSearchOrdered(node int, f func(int) bool) bool {
+	return trie.trie.PredictiveSearchOrdered(node, f)
+}
+
+// predictiveSearchBreadthFirstUntil は、PredictiveSearchBreadthFirstと同じ順にノードを巡り、fがfalseを返したら打ち切る
+func (trie *LoudsPrefixTrie) predictiveSearchBreadthFirstUntil(node int, f func(int) bool) bool {
+	return trie.trie.predictiveSearchBreadthFirstUntil(node, f)
+}
+
 // BuildLoudsPrefixTrie は、ソート済みのkeysからトライを作成する
 func BuildLoudsPrefixTrie(keys [][]uint16) (*LoudsPrefixTrie, []uint32) {
 	// TAIL文字列を抽出
@@ -107,8 +121,7 @@ func BuildLoudsPrefixTrie(keys [][]uint16) (*LoudsPrefixTrie, []uint32) {
 		}
 	}
 	links := NewBitVector(linkList.Words, uint32(linkList.Size))
-	tailChars := make([]uint16, 0)
-	tailBitList := NewBitList()
+	tails := make([][]uint16, 0, tailSize)
 	a := make([]int, linkList.Size)
 	for i := 0; i < len(prefixStringNodes); i++ {
 		a[prefixStringNodes[i]] = i
@@ -116,25 +129,16 @@ func BuildLoudsPrefixTrie(keys [][]uint16) (*LoudsPrefixTrie, []uint32) {
 	for i := 0; i < linkList.Size; i++ {
 		if linkList.Get(i) {
 			keyIndex := a[i]
-			tail := keys[keyIndex][len(keys[keyIndex])-int(tailList[keyIndex]):]
-			// tail配列に文字を追加
-			tailChars = append(tailChars, tail...)
-			// tailBitsに文字の区切りと長さを追加
-			tailBitList.Add(false)
-			for j := 0; j < len(tail); j++ {
-				tailBitList.Add(true)
-			}
+			tails = append(tails, keys[keyIndex][len(keys[keyIndex])-int(tailList[keyIndex]):])
 		}
 	}
-	tailBits := NewBitVector(tailBitList.Words, uint32(tailBitList.Size))
 
 	// インスタンスを生成
 	trie := &LoudsPrefixTrie{
-		trie:      prefixTrie,
-		links:     links,
-		outs:      NewBitVector(outs.Words, uint32(outs.Size)),
-		tailBits:  tailBits,
-		tailChars: tailChars,
+		trie:  prefixTrie,
+		links: links,
+		outs:  NewBitVector(outs.Words, uint32(outs.Size)),
+		tail:  BuildTail(tails),
 	}
 	return trie, prefixStringNodes
 }
@@ -188,7 +192,12 @@ func (trie *LoudsPrefixTrie) Size() int {
 	return trie.trie.Size()
 }
 
+// NumOfNodes は、ノードの個数を返す。TAILの文字はノードに含めない
+func (trie *LoudsPrefixTrie) NumOfNodes() int {
+	return trie.trie.Size()
+}
+
 // IoSize is ...
 func (trie *LoudsPrefixTrie) IoSize() int {
-	return trie.trie.IoSize() + trie.outs.IoSize() + trie.links.IoSize() + trie.tailBits.IoSize() + IoSizeUint16Array(trie.tailChars)
+	return trie.trie.IoSize() + trie.outs.IoSize() + trie.links.IoSize() + trie.tail.IoSize()
 }
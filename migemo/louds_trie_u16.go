@@ -17,7 +17,8 @@ func NewLoudsTrie(bitVector *BitVector, edges []uint16) *LoudsTrieU16 {
 // ReverseLookup は、ノード番号indexからkeyを復元する
 func (trie *LoudsTrieU16) ReverseLookup(index uint32, key *[]uint16) int {
 	offset := len(*key)
-	for index > 1 {
+	// 壊れたトライで親をたどり続けないよう、深さをノードの個数までに制限する
+	for depth, size := 0, trie.Size(); index > 1 && depth < size; depth++ {
 		*key = append(*key, trie.edges[index])
 		index = trie.Parent(index)
 	}
@@ -72,6 +73,18 @@ func (trie *LoudsTrieU16) Lookup(key []uint16) int {
 	return -1
 }
 
+// CommonPrefixSearch は、keyの接頭辞になっている全てのキーについて、その長さとノード番号を短い順に関数fに返す。根は含めない
+func (trie *LoudsTrieU16) CommonPrefixSearch(key []uint16, f func(keyLen int, node int)) {
+	node := 1
+	for i, c := range key {
+		node = trie.Traverse(uint32(node), c)
+		if node == -1 {
+			return
+		}
+		f(i+1, node)
+	}
+}
+
 // PredictiveSearchDepthFirst は、指定したノードから葉の方向に全てのノードを深さ優先で巡る
 func (trie *LoudsTrieU16) PredictiveSearchDepthFirst(index int, f func(int, []uint16)) {
 	key := make([]uint16, 0, 8)
@@ -104,6 +117,41 @@ func (trie *LoudsTrieU16) predictiveSearchDepthFirstInternal(index int, key *[]u
 	}
 }
 
+// PredictiveSearchOrdered は、指定したノードから葉の方向に全てのノードを、キーの辞書順(行きがけ順)に巡る。
+// fがfalseを返したら打ち切り、trueを返す
+func (trie *LoudsTrieU16) PredictiveSearchOrdered(node int, f func(int) bool) bool {
+	if !f(node) {
+		return true
+	}
+	childPos := trie.bitVector.Select(uint32(node), false) + 1
+	size := uint(trie.bitVector.Size())
+	if childPos >= size || !trie.bitVector.Get(uint32(childPos)) {
+		return false
+	}
+	child := int(trie.bitVector.Rank(childPos, true)) + 1
+	for ; childPos < size && trie.bitVector.Get(uint32(childPos)); childPos++ {
+		if trie.PredictiveSearchOrdered(child, f) {
+			return true
+		}
+		child++
+	}
+	return false
+}
+
+// childStart は、ノードnodeの最初の子のノード番号を返す。子がなければ、nodeより後のノードの最初の子のノード番号を返す。
+// nodeが最後のノードより後なら、最後のノードの次の番号を返す
+func (trie *LoudsTrieU16) childStart(node uint) uint {
+	last := uint(trie.Size() + 1)
+	if node > last {
+		return last + 1
+	}
+	pos := trie.bitVector.Select(uint32(node), false) + 1
+	if pos >= uint(trie.bitVector.Size()) {
+		return last + 1
+	}
+	return trie.bitVector.Rank(pos, true) + 1
+}
+
 // PredictiveSearchBreadthFirst は、指定したノードから葉の方向に全てのノードを幅優先で巡る．
 func (trie *LoudsTrieU16) PredictiveSearchBreadthFirst(node int, f func(int)) {
 	lower := uint(node)
@@ -112,9 +160,26 @@ func (trie *LoudsTrieU16) PredictiveSearchBreadthFirst(node int, f func(int)) {
 		for i := lower; i < upper; i++ {
 			f(int(i))
 		}
-		lower = trie.bitVector.Rank(trie.bitVector.Select(uint32(lower), false)+1, true) + 1
-		upper = trie.bitVector.Rank(trie.bitVector.Select(uint32(upper), false)+1, true) + 1
+		lower = trie.childStart(lower)
+		upper = trie.childStart(upper)
+	}
+}
+
+// predictiveSearchBreadthFirstUntil は、PredictiveSearchBreadthFirstと同じ順にノードを巡り、fがfalseを返したら打ち切る。
+// 打ち切った場合はtrueを返す
+func (trie *LoudsTrieU16) predictiveSearchBreadthFirstUntil(node int, f func(int) bool) bool {
+	lower := uint(node)
+	upper := uint(node + 1)
+	for upper-lower > 0 {
+		for i := lower; i < upper; i++ {
+			if !f(int(i)) {
+				return true
+			}
+		}
+		lower = trie.childStart(lower)
+		upper = trie.childStart(upper)
 	}
+	return false
 }
 
 // Size は、ノードの個数を返す
@@ -122,6 +187,11 @@ func (trie *LoudsTrieU16) Size() int {
 	return len(trie.edges) - 2
 }
 
+// NumOfNodes は、ノードの個数を返す。Sizeと同じ
+func (trie *LoudsTrieU16) NumOfNodes() int {
+	return trie.Size()
+}
+
 func binarySearchUint16(a []uint16, fromIndex uint32, toIndex uint32, key uint16) int {
 	var low = fromIndex
 	var high = toIndex - 1
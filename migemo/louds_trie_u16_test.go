@@ -1,6 +1,8 @@
 package migemo_test
 
 import (
+	"math/rand"
+	"sort"
 	"testing"
 	"unicode/utf16"
 
@@ -64,3 +66,47 @@ func TestLoudsTrie_PredictiveSearchBreadthFirst(t *testing.T) {
 		}
 	}
 }
+
+func TestLoudsTrie_PredictiveSearchBreadthFirst_LastNode(t *testing.T) {
+	// ビット列の長さが64の倍数になるトライで、最後のノードの次を読まないことを確かめる
+	random := rand.New(rand.NewSource(1))
+	for n := 1; n <= 100; n++ {
+		set := make(map[string]bool)
+		for len(set) < n {
+			key := make([]rune, random.Intn(6)+1)
+			for i := range key {
+				key[i] = rune('あ' + 2*random.Intn(3))
+			}
+			set[string(key)] = true
+		}
+		words := make([]string, 0, n)
+		for w := range set {
+			words = append(words, w)
+		}
+		sort.Strings(words)
+		keys := make([][]uint16, n)
+		for i, w := range words {
+			keys[i] = utf16.Encode([]rune(w))
+		}
+		u16, _ := migemo.BuildLoudsTrie(keys)
+		u8, _ := migemo.BuildLoudsTrieU8(words)
+		for node := 1; node <= u16.Size()+1; node++ {
+			expected := 0
+			u16.PredictiveSearchOrdered(node, func(int) bool { expected++; return true })
+			actual := 0
+			u16.PredictiveSearchBreadthFirst(node, func(int) { actual++ })
+			if expected != actual {
+				t.Fatalf("keys:%v node:%d expected:%d actual:%d", words, node, expected, actual)
+			}
+		}
+		for node := 1; node <= u8.Size()+1; node++ {
+			expected := 0
+			u8.PredictiveSearchOrdered(node, func(int) bool { expected++; return true })
+			actual := 0
+			u8.PredictiveSearchBreadthFirst(node, func(int) { actual++ })
+			if expected != actual {
+				t.Fatalf("u8 keys:%v node:%d expected:%d actual:%d", words, node, expected, actual)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package migemo
+
+// MappedDictionary は、メモリマップした辞書ファイルを参照するCompactDictionary
+type MappedDictionary struct {
+	*CompactDictionary
+	data []uint8
+}
+
+// OpenMappedDictionary は、辞書ファイルをメモリマップして読み込む。
+// WriteMappableToで書き込んだ辞書であれば、BitVectorやエッジ、マッピングの配列はコピーされず、
+// マップしたファイルを直接参照する。それ以外の辞書や圧縮された辞書は通常通りメモリに読み込まれる。
+// 開くたびにファイル全体を読まないよう、WriteMappableToで書き込んだ辞書ではペイロードのCRCを検査しない。
+// 信頼できないファイルは、Verifyで検査してから使う
+func OpenMappedDictionary(path string) (*MappedDictionary, error) {
+	data, err := mmapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mapped := DetectCompression(data) == CompressionNone && len(data) >= dictionaryHeaderSize &&
+		data[len(dictionaryMagic)+1] == dictionaryVersionMapped
+	var dict *CompactDictionary
+	if mapped {
+		dict = &CompactDictionary{}
+		err = dict.decode(data, false)
+	} else {
+		dict, err = NewCompactDictionary(data)
+	}
+	if err != nil {
+		munmapFile(data)
+		return nil, err
+	}
+	if !mapped {
+		// 全てコピー済みか、展開したバッファを参照しているので、マップは不要
+		munmapFile(data)
+		data = nil
+	}
+	return &MappedDictionary{
+		CompactDictionary: dict,
+		data:              data,
+	}, nil
+}
+
+// Verify は、ペイロードのCRCを検査したあと、CompactDictionary.Verifyと同様に辞書の内部構造を検査する
+func (dict *MappedDictionary) Verify() error {
+	if dict.data != nil {
+		if err := checkPayloadCRC32(dict.data); err != nil {
+			return err
+		}
+	}
+	return dict.CompactDictionary.Verify()
+}
+
+// Close は、メモリマップを解除する。Closeした後に辞書を使用してはならない
+func (dict *MappedDictionary) Close() error {
+	if dict.data == nil {
+		return nil
+	}
+	err := munmapFile(dict.data)
+	dict.data = nil
+	dict.CompactDictionary = nil
+	return err
+}
@@ -0,0 +1,178 @@
+package migemo_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func TestMappedDictionary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	if _, err := LoadCompactDictionary().WriteMappableTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "migemo-compact-dict")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dict, err := migemo.OpenMappedDictionary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dict.Close()
+	list := []string{}
+	dict.Search(utf16.Encode([]rune("とうきょうと")), func(s []uint16) {
+		list = append(list, string(utf16.Decode(s)))
+	})
+	if len(list) != 1 || list[0] != "東京都" {
+		t.Errorf("expected:[東京都] actual:%v", list)
+	}
+	list = list[:0]
+	dict.PredictiveSearch(utf16.Encode([]rune("かながわけ")), func(s []uint16) {
+		list = append(list, string(utf16.Decode(s)))
+	})
+	if len(list) == 0 || list[0] != "神奈川県" {
+		t.Errorf("expected:[神奈川県 ...] actual:%v", list)
+	}
+}
+
+func TestMappedDictionary_Verify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f, err := os.Open("../testdata/todofuken.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	source, err := migemo.BuildDictionaryFromMigemoDictFile(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := source.WriteMappableTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "migemo-compact-dict")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dict, err := migemo.OpenMappedDictionary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dict.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	dict.Close()
+
+	// 開くときはペイロードのCRCを検査せず、Verifyで検査する
+	data := buf.Bytes()
+	data[len(data)-1] ^= 0xff
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dict, err = migemo.OpenMappedDictionary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dict.Close()
+	if err := dict.Verify(); !errors.Is(err, migemo.ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, actual:%v", err)
+	}
+	if _, err := migemo.NewCompactDictionary(data); !errors.Is(err, migemo.ErrChecksumMismatch) {
+		t.Errorf("NewCompactDictionary must check the CRC: %v", err)
+	}
+}
+
+func TestMappedDictionary_Verify_RankIndex(t *testing.T) {
+	text := "かんじ\t漢字\t幹事\nかんじょう\t感情\nかんさい\t関西\n"
+	source, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{TrieType: migemo.TrieTypeLouds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	source.WriteMappableTo(&buf)
+	data := buf.Bytes()
+	// ペイロードの各バイトを書き換えてCRCを直し、Rankの索引の不整合がVerifyで見つかることを確かめる
+	found := false
+	for i := 28; i < len(data); i++ {
+		corrupted := append([]byte{}, data...)
+		corrupted[i] ^= 0x01
+		binary.BigEndian.PutUint32(corrupted[24:], crc32.ChecksumIEEE(corrupted[28:]))
+		dict, err := migemo.NewCompactDictionary(corrupted)
+		if err != nil {
+			continue
+		}
+		var verifyError *migemo.VerifyError
+		if err := dict.Verify(); errors.As(err, &verifyError) {
+			component := verifyError.Issues[0].Component
+			found = found || strings.HasSuffix(component, ".lb") || strings.HasSuffix(component, ".sb")
+		}
+	}
+	if !found {
+		t.Error("inconsistent rank index is not reported")
+	}
+}
+
+func TestMappedDictionary_Version1(t *testing.T) {
+	dict, err := migemo.OpenMappedDictionary("../testdata/migemo-compact-dict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dict.Close()
+	list := []string{}
+	dict.Search(utf16.Encode([]rune("とうきょうと")), func(s []uint16) {
+		list = append(list, string(utf16.Decode(s)))
+	})
+	if len(list) != 1 || list[0] != "東京都" {
+		t.Errorf("expected:[東京都] actual:%v", list)
+	}
+}
+
+func BenchmarkOpenMappedDictionary(b *testing.B) {
+	dir, err := ioutil.TempDir("", "migemo")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	LoadCompactDictionary().WriteMappableTo(&buf)
+	path := filepath.Join(dir, "migemo-compact-dict")
+	ioutil.WriteFile(path, buf.Bytes(), 0644)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dict, err := migemo.OpenMappedDictionary(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		dict.Close()
+	}
+}
+
+func BenchmarkNewCompactDictionary(b *testing.B) {
+	buf, err := ioutil.ReadFile("../testdata/migemo-compact-dict")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		migemo.NewCompactDictionary(buf)
+	}
+}
@@ -0,0 +1,312 @@
+package migemo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// dictionaryVersionMapped は、メモリマップで読み込むための辞書ファイルのバージョン。
+// ペイロードはリトルエンディアンで、全ての配列は8バイト境界に揃えて格納する
+const dictionaryVersionMapped = 2
+
+var nativeLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*uint8)(unsafe.Pointer(&x)) == 1
+}()
+
+// mappedReader は、バージョン2のペイロードを読み込む。
+// 実行環境がリトルエンディアンで配列が整列していれば、コピーせずにbufferを直接参照する
+type mappedReader struct {
+	binaryReader
+}
+
+func newMappedReader(buffer []uint8, offset int) *mappedReader {
+	return &mappedReader{
+		binaryReader{
+			buffer: buffer,
+			offset: offset,
+		},
+	}
+}
+
+func (reader *mappedReader) align() {
+	reader.next((8 - reader.offset%8) % 8)
+}
+
+func (reader *mappedReader) readUint32() uint32 {
+	b := reader.next(4)
+	reader.align()
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (reader *mappedReader) readLength(elementSize int) []uint8 {
+	size := int(reader.readUint32())
+	b := reader.next(size * elementSize)
+	reader.align()
+	return b
+}
+
+func (reader *mappedReader) readUint8Array() []uint8 {
+	b := reader.readLength(1)
+	if reader.err != nil {
+		return nil
+	}
+	if len(b) == 0 {
+		return []uint8{}
+	}
+	return b
+}
+
+func (reader *mappedReader) readUint16Array() []uint16 {
+	b := reader.readLength(2)
+	if reader.err != nil {
+		return nil
+	}
+	if len(b) == 0 {
+		return []uint16{}
+	}
+	if nativeLittleEndian && uintptr(unsafe.Pointer(&b[0]))%2 == 0 {
+		var array []uint16
+		header := (*reflect.SliceHeader)(unsafe.Pointer(&array))
+		header.Data = uintptr(unsafe.Pointer(&b[0]))
+		header.Len = len(b) / 2
+		header.Cap = len(b) / 2
+		return array
+	}
+	array := make([]uint16, len(b)/2)
+	for i := range array {
+		array[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return array
+}
+
+func (reader *mappedReader) readUint32Array() []uint32 {
+	b := reader.readLength(4)
+	if reader.err != nil {
+		return nil
+	}
+	if len(b) == 0 {
+		return []uint32{}
+	}
+	if nativeLittleEndian && uintptr(unsafe.Pointer(&b[0]))%4 == 0 {
+		var array []uint32
+		header := (*reflect.SliceHeader)(unsafe.Pointer(&array))
+		header.Data = uintptr(unsafe.Pointer(&b[0]))
+		header.Len = len(b) / 4
+		header.Cap = len(b) / 4
+		return array
+	}
+	array := make([]uint32, len(b)/4)
+	for i := range array {
+		array[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return array
+}
+
+func (reader *mappedReader) readUint64Array() []uint64 {
+	b := reader.readLength(8)
+	if reader.err != nil {
+		return nil
+	}
+	if len(b) == 0 {
+		return []uint64{}
+	}
+	if nativeLittleEndian && uintptr(unsafe.Pointer(&b[0]))%8 == 0 {
+		var array []uint64
+		header := (*reflect.SliceHeader)(unsafe.Pointer(&array))
+		header.Data = uintptr(unsafe.Pointer(&b[0]))
+		header.Len = len(b) / 8
+		header.Cap = len(b) / 8
+		return array
+	}
+	array := make([]uint64, len(b)/8)
+	for i := range array {
+		array[i] = binary.LittleEndian.Uint64(b[i*8:])
+	}
+	return array
+}
+
+// readBitVector は、ビット配列とRankの索引(lb,sb)をそのまま読み込み、Selectの索引を作成する
+func (reader *mappedReader) readBitVector() *BitVector {
+	sizeInBits := reader.readUint32()
+	words := reader.readUint64Array()
+	lb := reader.readUint32Array()
+	sb := reader.readUint16Array()
+	if reader.err != nil {
+		return nil
+	}
+	if uint32(len(words)) != (sizeInBits+63)/64 || uint32(len(lb)) != (sizeInBits+511)/512 || len(sb) != len(lb)*8 {
+		reader.err = ErrCorruptDictionary
+		return nil
+	}
+	return newBitVectorWithIndex(words, sizeInBits, lb, sb)
+}
+
+func (reader *mappedReader) readBitList() *BitList {
+	size := reader.readUint32()
+	words := reader.readUint64Array()
+	if reader.err != nil {
+		return nil
+	}
+	if uint32(len(words)) < (size+63)/64 {
+		reader.err = ErrCorruptDictionary
+		return nil
+	}
+	return &BitList{
+		Words: words,
+		Size:  int(size),
+	}
+}
+
+func (reader *mappedReader) readLoudsTrie() *LoudsTrieU16 {
+	edges := reader.readUint16Array()
+	return NewLoudsTrie(reader.readBitVector(), edges)
+}
+
+func (reader *mappedReader) readLoudsDoubleTrie() *LoudsDoubleTrie {
+	return &LoudsDoubleTrie{
+		prefixTrie:    reader.readLoudsTrie(),
+		tailTrie:      reader.readLoudsTrie(),
+		outs:          reader.readBitVector(),
+		linkBitVector: reader.readBitVector(),
+		linkArray:     reader.readUint32Array(),
+	}
+}
+
+func (reader *mappedReader) readTail() *Tail {
+	return &Tail{
+		chars:   reader.readUint16Array(),
+		starts:  reader.readBitVector(),
+		shared:  reader.readBitVector(),
+		offsets: reader.readUint32Array(),
+	}
+}
+
+// readTrie は、trieTypeの種類のトライを読み込む
+func (reader *mappedReader) readTrie(trieType TrieType) Trie {
+	switch trieType {
+	case TrieTypeLouds:
+		return reader.readLoudsTrie()
+	case TrieTypeDouble:
+		return reader.readLoudsDoubleTrie()
+	case TrieTypePrefix:
+		return &LoudsPrefixTrie{
+			trie:  reader.readLoudsTrie(),
+			outs:  reader.readBitVector(),
+			links: reader.readBitVector(),
+			tail:  reader.readTail(),
+		}
+	case TrieTypePatricia:
+		return &LoudsPatriciaTrie{
+			trie:  reader.readLoudsTrie(),
+			outs:  reader.readBitVector(),
+			links: reader.readBitVector(),
+			tail:  reader.readTail(),
+		}
+	}
+	reader.err = fmt.Errorf("%w: %s", ErrUnsupportedTrieType, trieType)
+	return nil
+}
+
+// mappedWriter は、バージョン2のペイロードを書き込む
+type mappedWriter struct {
+	buffer []uint8
+}
+
+func (writer *mappedWriter) align() {
+	for len(writer.buffer)%8 != 0 {
+		writer.buffer = append(writer.buffer, 0)
+	}
+}
+
+func (writer *mappedWriter) writeUint32(x uint32) {
+	writer.buffer = append(writer.buffer, uint8(x), uint8(x>>8), uint8(x>>16), uint8(x>>24))
+	writer.align()
+}
+
+func (writer *mappedWriter) writeUint8Array(array []uint8) {
+	writer.writeUint32(uint32(len(array)))
+	writer.buffer = append(writer.buffer, array...)
+	writer.align()
+}
+
+func (writer *mappedWriter) writeUint16Array(array []uint16) {
+	writer.writeUint32(uint32(len(array)))
+	for _, x := range array {
+		writer.buffer = append(writer.buffer, uint8(x), uint8(x>>8))
+	}
+	writer.align()
+}
+
+func (writer *mappedWriter) writeUint32Array(array []uint32) {
+	writer.writeUint32(uint32(len(array)))
+	for _, x := range array {
+		writer.buffer = append(writer.buffer, uint8(x), uint8(x>>8), uint8(x>>16), uint8(x>>24))
+	}
+	writer.align()
+}
+
+func (writer *mappedWriter) writeUint64Array(array []uint64) {
+	writer.writeUint32(uint32(len(array)))
+	b := make([]uint8, 8)
+	for _, x := range array {
+		binary.LittleEndian.PutUint64(b, x)
+		writer.buffer = append(writer.buffer, b...)
+	}
+}
+
+func (writer *mappedWriter) writeBitVector(bitVector *BitVector) {
+	writer.writeUint32(bitVector.sizeInBits)
+	writer.writeUint64Array(bitVector.words)
+	writer.writeUint32Array(bitVector.lb)
+	writer.writeUint16Array(bitVector.sb)
+}
+
+func (writer *mappedWriter) writeBitList(bitList *BitList) {
+	writer.writeUint32(uint32(bitList.Size))
+	writer.writeUint64Array(bitList.Words[:(bitList.Size+63)/64])
+}
+
+func (writer *mappedWriter) writeLoudsTrie(trie *LoudsTrieU16) {
+	writer.writeUint16Array(trie.edges)
+	writer.writeBitVector(trie.bitVector)
+}
+
+func (writer *mappedWriter) writeLoudsDoubleTrie(trie *LoudsDoubleTrie) {
+	writer.writeLoudsTrie(trie.prefixTrie)
+	writer.writeLoudsTrie(trie.tailTrie)
+	writer.writeBitVector(trie.outs)
+	writer.writeBitVector(trie.linkBitVector)
+	writer.writeUint32Array(trie.linkArray)
+}
+
+func (writer *mappedWriter) writeTrie(trie Trie) {
+	switch trie := trie.(type) {
+	case *LoudsTrieU16:
+		writer.writeLoudsTrie(trie)
+	case *LoudsDoubleTrie:
+		writer.writeLoudsDoubleTrie(trie)
+	case *LoudsPrefixTrie:
+		writer.writeLoudsTrie(trie.trie)
+		writer.writeBitVector(trie.outs)
+		writer.writeBitVector(trie.links)
+		writer.writeTail(trie.tail)
+	case *LoudsPatriciaTrie:
+		writer.writeLoudsTrie(trie.trie)
+		writer.writeBitVector(trie.outs)
+		writer.writeBitVector(trie.links)
+		writer.writeTail(trie.tail)
+	}
+}
+
+func (writer *mappedWriter) writeTail(tail *Tail) {
+	writer.writeUint16Array(tail.chars)
+	writer.writeBitVector(tail.starts)
+	writer.writeBitVector(tail.shared)
+	writer.writeUint32Array(tail.offsets)
+}
@@ -2,58 +2,298 @@ package migemo
 
 import (
 	"regexp"
+	"sort"
 	"strings"
 	"unicode/utf16"
 )
 
+// QueryOptions は、QueryAWordで辞書から展開する単語と、生成する正規表現の大きさを制限する
+type QueryOptions struct {
+	// MaxCandidates は、辞書から展開する単語の最大数。0なら制限しない。
+	// 重みを持つ辞書では重みの大きい順に、それ以外では辞書が返した順に選ぶ
+	MaxCandidates int
+	// MinWeight は、辞書から展開する単語の重みの下限。重みを持たない辞書では無視する
+	MinWeight uint8
+	// MaxPatternLength は、生成する正規表現の最大の文字数。0なら制限しない。
+	// 超える場合は、優先度の低い単語から取り除く。辞書の単語を全て取り除いても超える場合は、そのまま返す
+	MaxPatternLength int
+	// MaxVisitedNodes は、一つの単語の処理で前方一致検索と打ち間違いを許す検索が巡る辞書のノード数の上限。0なら制限しない。
+	// 前方一致検索ではBoundedDictionaryを、打ち間違いを許す検索ではBoundedFuzzyDictionaryを実装しない辞書で無視する
+	MaxVisitedNodes int
+	// FuzzyDistance は、辞書から単語が一つも見つからなかったときに、読みの打ち間違いとして許す編集距離。0なら許さない。
+	// FuzzyDictionaryを実装しない辞書では無視する
+	FuzzyDistance int
+}
+
+func (options *QueryOptions) limited() bool {
+	return options != nil && (options.MaxCandidates > 0 || options.MinWeight > 0 || options.MaxPatternLength > 0 || options.MaxVisitedNodes > 0)
+}
+
+// QueryResult は、QueryOptionsで制限したmigemoクエリの結果
+type QueryResult struct {
+	// Pattern は、生成した正規表現
+	Pattern string
+	// Truncated は、いずれかの制限に達し、辞書の単語の一部を展開しなかったことを示す
+	Truncated bool
+}
+
+// candidateCollector は、辞書から展開した単語を集め、QueryOptionsに従って絞り込む
+type candidateCollector struct {
+	dict      Dictionary
+	weighted  WeightedDictionary
+	bounded   BoundedDictionary
+	options   *QueryOptions
+	generator *TernaryRegexGenerator
+	words     [][]rune
+	weights   []uint8
+	indices   map[string]int
+	// found は、辞書が返した単語の数。絞り込みで除いた単語も数える
+	found int
+	// remainingNodes は、前方一致検索と打ち間違いを許す検索で巡ることのできる残りのノード数
+	remainingNodes int
+	truncated      bool
+}
+
+func newCandidateCollector(dict Dictionary, options *QueryOptions, generator *TernaryRegexGenerator) *candidateCollector {
+	collector := &candidateCollector{
+		dict:      dict,
+		generator: generator,
+	}
+	if options.limited() {
+		collector.options = options
+		collector.indices = make(map[string]int)
+		if weighted, ok := dict.(WeightedDictionary); ok && weighted.HasWeights() {
+			collector.weighted = weighted
+		}
+		if options.MaxVisitedNodes > 0 {
+			collector.remainingNodes = options.MaxVisitedNodes
+			if bounded, ok := dict.(BoundedDictionary); ok {
+				collector.bounded = bounded
+			}
+		}
+	}
+	return collector
+}
+
+func (collector *candidateCollector) search(key []uint16) {
+	if collector.options == nil {
+		collector.dict.PredictiveSearch(key, func(word []uint16) {
+			collector.found++
+			collector.generator.Add([]rune(utf16.Decode(word)))
+		})
+		return
+	}
+	if collector.bounded != nil {
+		if collector.remainingNodes <= 0 {
+			collector.truncated = true
+			return
+		}
+		visited, truncated := collector.bounded.PredictiveSearchBounded(key, collector.remainingNodes, collector.add)
+		collector.remainingNodes -= visited
+		collector.truncated = collector.truncated || truncated
+		return
+	}
+	if collector.weighted != nil {
+		collector.weighted.PredictiveSearchWeighted(key, collector.add)
+		return
+	}
+	collector.dict.PredictiveSearch(key, func(word []uint16) {
+		collector.add(word, 0)
+	})
+}
+
+func (collector *candidateCollector) add(word []uint16, weight uint8) {
+	collector.found++
+	if collector.weighted != nil && weight < collector.options.MinWeight {
+		return
+	}
+	runes := []rune(utf16.Decode(word))
+	s := string(runes)
+	if i, ok := collector.indices[s]; ok {
+		if collector.weights[i] < weight {
+			collector.weights[i] = weight
+		}
+		return
+	}
+	if collector.weighted == nil && collector.options.MaxCandidates > 0 && len(collector.words) >= collector.options.MaxCandidates {
+		// 重みがなければ先に見つかった単語を優先するので、これ以上集める必要はない
+		collector.truncated = true
+		return
+	}
+	collector.indices[s] = len(collector.words)
+	collector.words = append(collector.words, runes)
+	collector.weights = append(collector.weights, weight)
+}
+
+// searchFuzzy は、keysとの編集距離がmaxDistance以下の読みの単語を、編集距離の小さい順に集める
+func (collector *candidateCollector) searchFuzzy(keys [][]uint16, maxDistance int) {
+	fuzzy, ok := collector.dict.(FuzzyDictionary)
+	if !ok {
+		return
+	}
+	type fuzzyCandidate struct {
+		word     []uint16
+		weight   uint8
+		distance int
+	}
+	candidates := make([]fuzzyCandidate, 0)
+	add := func(_ []uint16, word []uint16, weight uint8, distance int) {
+		candidates = append(candidates, fuzzyCandidate{append([]uint16(nil), word...), weight, distance})
+	}
+	bounded, ok := fuzzy.(BoundedFuzzyDictionary)
+	for _, key := range keys {
+		if !ok || collector.options == nil || collector.options.MaxVisitedNodes <= 0 {
+			fuzzy.FuzzySearch(key, maxDistance, add)
+			continue
+		}
+		if collector.remainingNodes <= 0 {
+			collector.truncated = true
+			break
+		}
+		visited, truncated := bounded.FuzzySearchBounded(key, maxDistance, collector.remainingNodes, add)
+		collector.remainingNodes -= visited
+		collector.truncated = collector.truncated || truncated
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+	for _, candidate := range candidates {
+		if collector.options == nil {
+			collector.generator.Add([]rune(utf16.Decode(candidate.word)))
+		} else {
+			collector.add(candidate.word, candidate.weight)
+		}
+	}
+}
+
+// selected は、集めた単語を優先度の高い順に並べ、MaxCandidatesまでに絞り込んで返す
+func (collector *candidateCollector) selected() [][]rune {
+	order := make([]int, len(collector.words))
+	for i := range order {
+		order[i] = i
+	}
+	if collector.weighted != nil {
+		sort.SliceStable(order, func(i, j int) bool { return collector.weights[order[i]] > collector.weights[order[j]] })
+	}
+	if max := collector.options.MaxCandidates; max > 0 && len(order) > max {
+		order = order[:max]
+		collector.truncated = true
+	}
+	words := make([][]rune, len(order))
+	for i, j := range order {
+		words[i] = collector.words[j]
+	}
+	return words
+}
+
 // QueryAWord は、migemoクエリを処理する
-func QueryAWord(word string, dict *CompactDictionary, operator *RegexOperator) string {
-	var utf32word = []rune(word)
+func QueryAWord(word string, dict Dictionary, operator *RegexOperator) string {
+	return QueryAWordWithOptions(word, dict, operator, nil).Pattern
+}
+
+// QueryAWordWithOptions は、辞書から展開する単語と正規表現の大きさをoptionsで制限してmigemoクエリを処理する。
+// optionsがnilなら制限しない
+func QueryAWordWithOptions(word string, dict Dictionary, operator *RegexOperator, options *QueryOptions) QueryResult {
 	var generator = NewTernaryRegexGenerator(*operator)
-	generator.Add(utf32word)
+	// 辞書以外から得た単語は、正規表現を作り直すときのために残しておく
+	var words = make([][]rune, 0, 16)
+	add := func(w []rune) {
+		words = append(words, w)
+		generator.Add(w)
+	}
+	var utf32word = []rune(word)
+	add(utf32word)
 	var lower = strings.ToLower(word)
+	var candidates *candidateCollector
 	if dict != nil {
+		candidates = newCandidateCollector(dict, options, generator)
 		//var utf8lower = []byte(string([]rune(lower)))
 		var utf16lower = utf16.Encode([]rune(lower))
-		dict.PredictiveSearch(utf16lower, func(word []uint16) {
-			generator.Add([]rune(utf16.Decode(word)))
-		})
+		candidates.search(utf16lower)
 	}
 	var zen = ConvertHan2Zen(word)
-	generator.Add([]rune(zen))
+	add([]rune(zen))
 	var han = ConvertZen2Han(word)
-	generator.Add([]rune(han))
+	add([]rune(han))
 
 	var romajiProcessor = NewRomajiProcessor2()
 	var hiraganaResult = romajiProcessor.RomajiToHiraganaPredictively(lower)
+	var readings = make([][]uint16, 0, len(hiraganaResult.Suffixes))
 	for _, a := range hiraganaResult.Suffixes {
 		var hira = hiraganaResult.Prefix + a
 		var utf32hira = []rune(hira)
 		var utf16hira = utf16.Encode(utf32hira)
-		generator.Add(utf32hira)
+		add(utf32hira)
 		if dict != nil {
-			dict.PredictiveSearch(utf16hira, func(word []uint16) {
-				generator.Add([]rune(utf16.Decode(word)))
-			})
+			candidates.search(utf16hira)
+			readings = append(readings, utf16hira)
 		}
 		var kata = ConvertHira2Kata(string(utf32hira))
-		generator.Add([]rune(kata))
-		generator.Add([]rune(ConvertZen2Han(kata)))
+		add([]rune(kata))
+		add([]rune(ConvertZen2Han(kata)))
+	}
+	if candidates != nil && candidates.found == 0 && options != nil && options.FuzzyDistance > 0 {
+		// 辞書から単語が見つからなければ、打ち間違いとみなして近い読みの単語を展開する
+		candidates.searchFuzzy(readings, options.FuzzyDistance)
+	}
+	if candidates == nil || candidates.options == nil {
+		return QueryResult{Pattern: string(generator.Generate())}
+	}
+
+	selected := candidates.selected()
+	generate := func(n int) []rune {
+		generator := NewTernaryRegexGenerator(*operator)
+		for _, w := range words {
+			generator.Add(w)
+		}
+		for _, w := range selected[:n] {
+			generator.Add(w)
+		}
+		return generator.Generate()
+	}
+	pattern := generate(len(selected))
+	if max := options.MaxPatternLength; max > 0 && len(pattern) > max && len(selected) > 0 {
+		// 正規表現が制限に収まる最大の単語数を二分探索する。取り除ける辞書の単語がなければそのまま返す
+		candidates.truncated = true
+		lower, upper := 0, len(selected)-1
+		pattern = generate(0)
+		for lower < upper {
+			middle := (lower + upper + 1) / 2
+			if p := generate(middle); len(p) <= max {
+				lower = middle
+				pattern = p
+			} else {
+				upper = middle - 1
+			}
+		}
+	}
+	return QueryResult{
+		Pattern:   string(pattern),
+		Truncated: candidates.truncated,
 	}
-	return string(generator.Generate())
 }
 
 // Query は、migemoクエリを処理する
-func Query(word string, dict *CompactDictionary, operator *RegexOperator) string {
+func Query(word string, dict Dictionary, operator *RegexOperator) string {
+	return QueryWithOptions(word, dict, operator, nil).Pattern
+}
+
+// QueryWithOptions は、辞書から展開する単語と正規表現の大きさをoptionsで制限してmigemoクエリを処理する。
+// optionsがnilなら制限しない。MaxPatternLengthとMaxVisitedNodesは、クエリを分割した単語毎に適用する
+func QueryWithOptions(word string, dict Dictionary, operator *RegexOperator, options *QueryOptions) QueryResult {
 	if len(word) == 0 {
-		return ""
+		return QueryResult{}
 	}
 	words := parseQuery(word)
 	results := make([]string, len(words))
+	truncated := false
 	for i, w := range words {
-		results[i] = QueryAWord(w, dict, operator)
+		result := QueryAWordWithOptions(w, dict, operator, options)
+		results[i] = result.Pattern
+		truncated = truncated || result.Truncated
+	}
+	return QueryResult{
+		Pattern:   strings.Join(results, ""),
+		Truncated: truncated,
 	}
-	return strings.Join(results, "")
 }
 
 func parseQuery(query string) []string {
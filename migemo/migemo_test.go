@@ -2,7 +2,10 @@ package migemo_test
 
 import (
 	"bufio"
+	"bytes"
 	"os"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/oguna/gomigemo-experiments-2020/migemo"
@@ -28,7 +31,10 @@ func LoadMigemoDictionary() *migemo.CompactDictionary {
 		panic(err)
 	}
 	defer fp.Close()
-	dict := migemo.BuildDictionaryFromMigemoDictFile(fp)
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(fp, nil)
+	if err != nil {
+		panic(err)
+	}
 	return dict
 }
 
@@ -43,3 +49,135 @@ func BenchmarkMigemo_UTF8(b *testing.B) {
 		}
 	}
 }
+
+func TestQueryWithOptions(t *testing.T) {
+	text := "か\t蚊;10\t課;200\n" +
+		"かい\t貝;120\t会;250\t階\n" +
+		"かいしゃ\t社会;300\n"
+	options := &migemo.BuildOptions{Weighted: true}
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.Warnings) != 1 || options.Warnings[0].Kind != migemo.WarningInvalidWeight {
+		t.Errorf("invalid warnings: %v", options.Warnings)
+	}
+	var buf bytes.Buffer
+	if _, err := dict.WriteMappableTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := migemo.NewCompactDictionary(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf = bytes.Buffer{}
+	dict.WriteTo(&buf)
+	loaded, err := migemo.NewCompactDictionary(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	loaded.Export(&buf)
+	if expected := "か\t蚊;10\t課;200\nかい\t貝;120\t会;250\t階;0\nかいしゃ\t社会;255\n"; buf.String() != expected {
+		t.Errorf("expected:%q actual:%q", expected, buf.String())
+	}
+
+	operator := migemo.NewRegexOperator("|", "(", ")", "[", "]", "")
+	testcases := []struct {
+		options  *migemo.QueryOptions
+		contains []string
+		excludes []string
+	}{
+		{nil, []string{"蚊", "課", "貝", "会", "階", "社会"}, nil},
+		{&migemo.QueryOptions{MaxCandidates: 2}, []string{"社会", "会"}, []string{"蚊", "課", "貝", "階"}},
+		{&migemo.QueryOptions{MinWeight: 100}, []string{"課", "貝", "会", "社会"}, []string{"蚊", "階"}},
+	}
+	for _, dict := range []migemo.Dictionary{loaded, mapped} {
+		for _, tc := range testcases {
+			re := migemo.QueryWithOptions("ka", dict, operator, tc.options).Pattern
+			for _, w := range tc.contains {
+				if !strings.Contains(re, w) {
+					t.Errorf("%+v: %s is not found in %s", tc.options, w, re)
+				}
+			}
+			for _, w := range tc.excludes {
+				if strings.Contains(re, w) {
+					t.Errorf("%+v: %s is found in %s", tc.options, w, re)
+				}
+			}
+		}
+	}
+}
+
+func TestQueryWithOptions_Limits(t *testing.T) {
+	dict := LoadCompactDictionary()
+	operator := migemo.NewRegexOperator("|", "(", ")", "[", "]", "")
+	full := migemo.QueryWithOptions("a", dict, operator, nil)
+	if full.Truncated || full.Pattern != migemo.Query("a", dict, operator) {
+		t.Fatal("unlimited query must not be truncated")
+	}
+	testcases := []migemo.QueryOptions{
+		{MaxCandidates: 100},
+		{MaxPatternLength: 1000},
+		{MaxVisitedNodes: 100},
+	}
+	for _, options := range testcases {
+		result := migemo.QueryWithOptions("a", dict, operator, &options)
+		if !result.Truncated || len(result.Pattern) >= len(full.Pattern) {
+			t.Errorf("%+v: truncated:%t length:%d", options, result.Truncated, len(result.Pattern))
+		}
+		if _, err := regexp.Compile(result.Pattern); err != nil {
+			t.Errorf("%+v: %v", options, err)
+		}
+	}
+	if result := migemo.QueryWithOptions("a", dict, operator, &migemo.QueryOptions{MaxPatternLength: 1000}); len([]rune(result.Pattern)) > 1000 {
+		t.Errorf("pattern is too long: %d", len([]rune(result.Pattern)))
+	}
+	generous := migemo.QueryWithOptions("kensaku", dict, operator, &migemo.QueryOptions{MaxCandidates: 100, MaxPatternLength: 10000, MaxVisitedNodes: 10000})
+	if generous.Truncated || generous.Pattern != migemo.Query("kensaku", dict, operator) {
+		t.Errorf("query within limits must not be truncated: %+v", generous)
+	}
+	// 辞書に単語がなければ、正規表現が長くても取り除く単語がないので、切り詰めたことにしない
+	none := migemo.QueryWithOptions("xqz", dict, operator, &migemo.QueryOptions{MaxPatternLength: 1})
+	if none.Truncated || none.Pattern != migemo.Query("xqz", dict, operator) {
+		t.Errorf("query without dictionary words must not be truncated: %+v", none)
+	}
+}
+
+func TestQueryWithOptions_FuzzyDistance(t *testing.T) {
+	dict := LoadCompactDictionary()
+	operator := migemo.NewRegexOperator("|", "(", ")", "[", "]", "")
+	if pattern := migemo.Query("kensku", dict, operator); strings.Contains(pattern, "検索") {
+		t.Fatalf("exact query must not contain 検索: %s", pattern)
+	}
+	for _, options := range []*migemo.QueryOptions{{FuzzyDistance: 1}, {FuzzyDistance: 1, MaxCandidates: 100}} {
+		result := migemo.QueryWithOptions("kensku", dict, operator, options)
+		if !regexp.MustCompile(result.Pattern).MatchString("検索") {
+			t.Errorf("%+v: 検索 is not matched: %s", options, result.Pattern)
+		}
+	}
+	budget := &migemo.QueryOptions{FuzzyDistance: 1, MaxVisitedNodes: 10}
+	if result := migemo.QueryWithOptions("kensku", dict, operator, budget); !result.Truncated || strings.Contains(result.Pattern, "検索") {
+		t.Errorf("fuzzy search must stop at MaxVisitedNodes: %+v", result)
+	}
+	exact := migemo.Query("kensaku", dict, operator)
+	if result := migemo.QueryWithOptions("kensaku", dict, operator, &migemo.QueryOptions{FuzzyDistance: 1}); result.Pattern != exact {
+		t.Errorf("fuzzy candidates must not be added when exact candidates are found: %s", result.Pattern)
+	}
+}
+
+func TestQuery_NilCompactDictionary(t *testing.T) {
+	var dict *migemo.CompactDictionary
+	operator := migemo.NewRegexOperator("|", "(", ")", "[", "]", "")
+	expected := migemo.Query("ka", nil, operator)
+	if actual := migemo.Query("ka", dict, operator); actual != expected {
+		t.Errorf("expected:%s actual:%s", expected, actual)
+	}
+	options := &migemo.QueryOptions{MaxCandidates: 10, MaxVisitedNodes: 100, FuzzyDistance: 1}
+	if result := migemo.QueryWithOptions("ka", dict, operator, options); result.Pattern != expected {
+		t.Errorf("expected:%s actual:%s", expected, result.Pattern)
+	}
+}
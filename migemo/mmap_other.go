@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package migemo
+
+import "io/ioutil"
+
+// mmapFile は、メモリマップが使えない環境ではファイルを全て読み込む
+func mmapFile(path string) ([]uint8, error) {
+	return ioutil.ReadFile(path)
+}
+
+func munmapFile(data []uint8) error {
+	return nil
+}
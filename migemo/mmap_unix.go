@@ -0,0 +1,32 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package migemo
+
+import (
+	"os"
+	"syscall"
+)
+
+func mmapFile(path string) ([]uint8, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return []uint8{}, nil
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmapFile(data []uint8) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,128 @@
+package migemo
+
+import (
+	"sort"
+	"unicode/utf16"
+)
+
+// mutableEntry は、MutableDictionaryにおける一つの読みとその単語
+type mutableEntry struct {
+	key   []uint16
+	words [][]uint16
+}
+
+// MutableDictionary は、実行中に単語の追加と削除ができる辞書。
+// 読みをUTF-16の辞書順に並べた配列で保持し、二分探索で検索する。
+// 複数のゴルーチンから同時に使用する場合は、呼び出し側で排他制御する必要がある
+type MutableDictionary struct {
+	entries []mutableEntry
+}
+
+// NewMutableDictionary は、空のMutableDictionaryを生成する
+func NewMutableDictionary() *MutableDictionary {
+	return &MutableDictionary{}
+}
+
+// lowerBound は、keyより小さくない最初の読みの位置を返す
+func (dict *MutableDictionary) lowerBound(key []uint16) int {
+	return sort.Search(len(dict.entries), func(i int) bool {
+		return CompareUtf16String(dict.entries[i].key, key) >= 0
+	})
+}
+
+func (dict *MutableDictionary) find(key []uint16) (int, bool) {
+	i := dict.lowerBound(key)
+	return i, i < len(dict.entries) && CompareUtf16String(dict.entries[i].key, key) == 0
+}
+
+// Add は、読みreadingに単語wordを追加する。既に登録されていればfalseを返す
+func (dict *MutableDictionary) Add(reading string, word string) bool {
+	if len(reading) == 0 || len(word) == 0 {
+		return false
+	}
+	key := utf16.Encode([]rune(reading))
+	value := utf16.Encode([]rune(word))
+	i, ok := dict.find(key)
+	if !ok {
+		dict.entries = append(dict.entries, mutableEntry{})
+		copy(dict.entries[i+1:], dict.entries[i:])
+		dict.entries[i] = mutableEntry{key: key}
+	}
+	entry := &dict.entries[i]
+	for _, w := range entry.words {
+		if CompareUtf16String(w, value) == 0 {
+			return false
+		}
+	}
+	entry.words = append(entry.words, value)
+	return true
+}
+
+// Remove は、読みreadingから単語wordを削除する。登録されていなければfalseを返す
+func (dict *MutableDictionary) Remove(reading string, word string) bool {
+	key := utf16.Encode([]rune(reading))
+	value := utf16.Encode([]rune(word))
+	i, ok := dict.find(key)
+	if !ok {
+		return false
+	}
+	entry := &dict.entries[i]
+	for j, w := range entry.words {
+		if CompareUtf16String(w, value) == 0 {
+			entry.words = append(entry.words[:j], entry.words[j+1:]...)
+			if len(entry.words) == 0 {
+				dict.entries = append(dict.entries[:i], dict.entries[i+1:]...)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Len は、登録されている読みの数を返す
+func (dict *MutableDictionary) Len() int {
+	return len(dict.entries)
+}
+
+// Search は、キーに一致する単語をコールバック関数fに返す
+func (dict *MutableDictionary) Search(key []uint16, f func([]uint16)) {
+	i, ok := dict.find(key)
+	if !ok {
+		return
+	}
+	for _, w := range dict.entries[i].words {
+		f(w)
+	}
+}
+
+// PredictiveSearch は、接頭辞がkeyに一致する全ての単語をコールバック関数fに返す
+func (dict *MutableDictionary) PredictiveSearch(key []uint16, f func([]uint16)) {
+	if len(key) == 0 {
+		return
+	}
+	for i := dict.lowerBound(key); i < len(dict.entries); i++ {
+		entry := dict.entries[i]
+		if len(entry.key) < len(key) || CompareUtf16String(entry.key[:len(key)], key) != 0 {
+			break
+		}
+		for _, w := range entry.words {
+			f(w)
+		}
+	}
+}
+
+// Freeze は、現在の内容からCompactDictionaryを生成する。
+// 生成後にMutableDictionaryを変更しても、生成したCompactDictionaryには反映されない
+func (dict *MutableDictionary) Freeze() (*CompactDictionary, error) {
+	keys := make([]string, len(dict.entries))
+	words := make(map[string][]string, len(dict.entries))
+	for i, entry := range dict.entries {
+		keys[i] = string(utf16.Decode(entry.key))
+		list := make([]string, len(entry.words))
+		for j, w := range entry.words {
+			list[j] = string(utf16.Decode(w))
+		}
+		words[keys[i]] = list
+	}
+	return buildCompactDictionary(keys, words, nil, TrieTypeDouble)
+}
@@ -0,0 +1,73 @@
+package migemo_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func TestMutableDictionary(t *testing.T) {
+	dict := migemo.NewMutableDictionary()
+	dict.Add("かんじ", "漢字")
+	dict.Add("かんじ", "幹事")
+	dict.Add("かんじょう", "感情")
+	dict.Add("かんさい", "関西")
+	dict.Add("か", "蚊")
+	if dict.Add("かんじ", "漢字") {
+		t.Error("duplicate word is added")
+	}
+	if !dict.Remove("かんじ", "幹事") || dict.Remove("かんじ", "幹事") {
+		t.Error("invalid Remove result")
+	}
+	if !dict.Remove("か", "蚊") || dict.Len() != 3 {
+		t.Errorf("empty reading is not removed. len:%d", dict.Len())
+	}
+
+	frozen, err := dict.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases := []struct {
+		key    string
+		expect string
+	}{
+		{"かんじ", "感情 漢字"},
+		{"かん", "感情 漢字 関西"},
+		{"か", "感情 漢字 関西"},
+		{"かんじょうせん", ""},
+	}
+	for _, tc := range testcases {
+		for name, search := range map[string]func([]uint16, func([]uint16)){
+			"mutable": dict.PredictiveSearch,
+			"frozen":  frozen.PredictiveSearch,
+		} {
+			actual := strings.Join(collectWords(search, tc.key), " ")
+			if actual != tc.expect {
+				t.Errorf("%s key:%s expected:%q actual:%q", name, tc.key, tc.expect, actual)
+			}
+		}
+	}
+
+	dict.Add("かんじ", "監事")
+	if actual := strings.Join(collectWords(frozen.Search, "かんじ"), " "); actual != "漢字" {
+		t.Errorf("frozen dictionary is changed: %q", actual)
+	}
+	if actual := strings.Join(collectWords(dict.Search, "かんじ"), " "); actual != "漢字 監事" {
+		t.Errorf("invalid Search result: %q", actual)
+	}
+}
+
+func TestMutableDictionary_Layer(t *testing.T) {
+	system := LoadCompactDictionary()
+	user := migemo.NewMutableDictionary()
+	dict := migemo.NewLayeredDictionary(system, migemo.DictionaryLayer{Dictionary: user})
+	operator := migemo.NewRegexOperator("|", "(", ")", "[", "]", "")
+	if re := migemo.Query("gomigemo", dict, operator); strings.Contains(re, "GoMigemo") {
+		t.Fatalf("unexpected word: %s", re)
+	}
+	user.Add("ごみげも", "GoMigemo")
+	if re := migemo.Query("gomigemo", dict, operator); !strings.Contains(re, "GoMigemo") {
+		t.Errorf("added word is not found: %s", re)
+	}
+}
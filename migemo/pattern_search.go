@@ -0,0 +1,276 @@
+package migemo
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// ErrInvalidKeyPattern は、キーのパターンの構文が正しくないことを示す
+var ErrInvalidKeyPattern = errors.New("migemo: invalid key pattern")
+
+type keyPatternKind int
+
+const (
+	keyPatternLiteral keyPatternKind = iota
+	// keyPatternAny は、任意の一文字
+	keyPatternAny
+	// keyPatternStar は、0文字以上の任意の文字列
+	keyPatternStar
+	// keyPatternClass は、文字クラスに含まれる一文字
+	keyPatternClass
+)
+
+type keyPatternElement struct {
+	kind keyPatternKind
+	// char は、keyPatternLiteralの文字
+	char rune
+	// ranges は、keyPatternClassに含まれる文字の範囲。先頭と末尾の文字を交互に並べる
+	ranges  []rune
+	negated bool
+}
+
+func (element *keyPatternElement) matches(r rune) bool {
+	switch element.kind {
+	case keyPatternLiteral:
+		return element.char == r
+	case keyPatternClass:
+		for i := 0; i < len(element.ranges); i += 2 {
+			if element.ranges[i] <= r && r <= element.ranges[i+1] {
+				return !element.negated
+			}
+		}
+		return element.negated
+	}
+	return true
+}
+
+// KeyPattern は、キーを検索するワイルドカードのパターン。
+// "?"は任意の一文字、"*"は0文字以上の任意の文字列、"[かきく]"や"[か-こ]"は括弧内のいずれかの一文字、
+// "[^か-こ]"は括弧内のいずれでもない一文字にマッチする。"\"は直後の文字をそのまま表す。
+// 括弧内では、"[[:hiragana:]]"や"[[:か行:]]"のように名前付きの文字クラスも使える。
+// 名前は、hiragana、katakanaと、濁音や小書きの仮名を含むひらがなの行(あ行からわ行まで)
+type KeyPattern struct {
+	elements []keyPatternElement
+}
+
+// CompileKeyPattern は、パターンの文字列を解析してKeyPatternを生成する
+func CompileKeyPattern(pattern string) (*KeyPattern, error) {
+	runes := []rune(pattern)
+	elements := make([]keyPatternElement, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '?':
+			elements = append(elements, keyPatternElement{kind: keyPatternAny})
+		case '*':
+			// 連続する"*"は一つにまとめる
+			if len(elements) == 0 || elements[len(elements)-1].kind != keyPatternStar {
+				elements = append(elements, keyPatternElement{kind: keyPatternStar})
+			}
+		case '[':
+			element, n, err := parseKeyPatternClass(runes[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s at %d in %q", ErrInvalidKeyPattern, err, i, pattern)
+			}
+			elements = append(elements, element)
+			i += n
+		case '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("%w: trailing backslash in %q", ErrInvalidKeyPattern, pattern)
+			}
+			i++
+			elements = append(elements, keyPatternElement{kind: keyPatternLiteral, char: runes[i]})
+		default:
+			elements = append(elements, keyPatternElement{kind: keyPatternLiteral, char: runes[i]})
+		}
+	}
+	return &KeyPattern{elements: elements}, nil
+}
+
+// namedKeyPatternClasses は、名前付きの文字クラスに含まれる文字の範囲。先頭と末尾の文字を交互に並べる
+var namedKeyPatternClasses = map[string][]rune{
+	"hiragana": {'ぁ', 'ゖ', 'ゝ', 'ゟ'},
+	"katakana": {'ァ', 'ヺ', 'ー', 'ヿ'},
+	"あ行":       {'ぁ', 'お'},
+	"か行":       {'か', 'ご'},
+	"さ行":       {'さ', 'ぞ'},
+	"た行":       {'た', 'ど'},
+	"な行":       {'な', 'の'},
+	"は行":       {'は', 'ぽ'},
+	"ま行":       {'ま', 'も'},
+	"や行":       {'ゃ', 'よ'},
+	"ら行":       {'ら', 'ろ'},
+	"わ行":       {'ゎ', 'を'},
+}
+
+// parseKeyPatternClass は、"["の直後から文字クラスを解析し、"]"までの文字数を返す
+func parseKeyPatternClass(runes []rune) (keyPatternElement, int, error) {
+	element := keyPatternElement{kind: keyPatternClass}
+	i := 0
+	if i < len(runes) && runes[i] == '^' {
+		element.negated = true
+		i++
+	}
+	for ; i < len(runes) && runes[i] != ']'; i++ {
+		if runes[i] == '[' && i+1 < len(runes) && runes[i+1] == ':' {
+			n := parseNamedKeyPatternClass(runes[i+2:])
+			if n < 0 {
+				return element, 0, errors.New("missing :]")
+			}
+			name := string(runes[i+2 : i+2+n])
+			ranges, ok := namedKeyPatternClasses[name]
+			if !ok {
+				return element, 0, fmt.Errorf("unknown character class %s", name)
+			}
+			element.ranges = append(element.ranges, ranges...)
+			i += n + 3
+			continue
+		}
+		if runes[i] == '\\' {
+			i++
+			if i == len(runes) {
+				break
+			}
+		}
+		first := runes[i]
+		last := first
+		if i+2 < len(runes) && runes[i+1] == '-' && runes[i+2] != ']' {
+			i += 2
+			if runes[i] == '\\' && i+1 < len(runes) {
+				i++
+			}
+			last = runes[i]
+			if last < first {
+				return element, 0, fmt.Errorf("invalid range %c-%c", first, last)
+			}
+		}
+		element.ranges = append(element.ranges, first, last)
+	}
+	if i == len(runes) {
+		return element, 0, errors.New("missing ]")
+	}
+	if len(element.ranges) == 0 {
+		return element, 0, errors.New("empty character class")
+	}
+	return element, i + 1, nil
+}
+
+// parseNamedKeyPatternClass は、"[:"の直後から":]"の直前までの文字数を返す。":]"がなければ-1
+func parseNamedKeyPatternClass(runes []rune) int {
+	for i := 0; i+1 < len(runes); i++ {
+		if runes[i] == ':' && runes[i+1] == ']' {
+			return i
+		}
+	}
+	return -1
+}
+
+// patternMatcher は、トライをたどりながらKeyPatternを非決定性オートマトンとして実行する。
+// 状態2*iはi番目の要素の直前、状態2*i+1はi番目の要素がサロゲートペアの上位を読んだ後を表す。
+// rows[d]は、深さdまでの文字列を読んだ後の状態の集合
+type patternMatcher struct {
+	elements []keyPatternElement
+	rows     [][]bool
+	// chars[d]は、深さdで読んだ文字
+	chars []uint16
+}
+
+func newPatternMatcher(pattern *KeyPattern) *patternMatcher {
+	matcher := &patternMatcher{
+		elements: pattern.elements,
+		rows:     [][]bool{make([]bool, 2*len(pattern.elements)+2)},
+	}
+	matcher.rows[0][0] = true
+	matcher.closure(matcher.rows[0])
+	return matcher
+}
+
+// closure は、"*"が0文字にマッチする場合の遷移を状態の集合に加える
+func (matcher *patternMatcher) closure(row []bool) {
+	for i, element := range matcher.elements {
+		if row[2*i] && element.kind == keyPatternStar {
+			row[2*(i+1)] = true
+		}
+	}
+}
+
+func (matcher *patternMatcher) push(depth int, c uint16) bool {
+	for len(matcher.rows) <= depth+1 {
+		matcher.rows = append(matcher.rows, make([]bool, 2*len(matcher.elements)+2))
+		matcher.chars = append(matcher.chars, 0)
+	}
+	matcher.chars[depth] = c
+	prev := matcher.rows[depth]
+	row := matcher.rows[depth+1]
+	for i := range row {
+		row[i] = false
+	}
+	high := 0xd800 <= c && c < 0xdc00
+	for i := range matcher.elements {
+		element := &matcher.elements[i]
+		if prev[2*i+1] && 0xdc00 <= c && c < 0xe000 && element.matches(utf16.DecodeRune(rune(matcher.chars[depth-1]), rune(c))) {
+			row[2*(i+1)] = true
+		}
+		if !prev[2*i] {
+			continue
+		}
+		switch {
+		case element.kind == keyPatternStar:
+			row[2*i] = true
+		case high:
+			row[2*i+1] = true
+		case element.matches(rune(c)):
+			row[2*(i+1)] = true
+		}
+	}
+	// サロゲートペアの途中では、次の要素に進まない
+	if !high {
+		matcher.closure(row)
+	}
+	for _, state := range row {
+		if state {
+			return true
+		}
+	}
+	return false
+}
+
+func (matcher *patternMatcher) accepts(depth int) bool {
+	return matcher.rows[depth][2*len(matcher.elements)]
+}
+
+// PatternSearch は、patternにマッチする全てのキーのノード番号を、キーの辞書順に関数fに返す
+func (trie *LoudsTrieU16) PatternSearch(pattern *KeyPattern, f func(node int)) {
+	trie.walkAutomaton(1, newPatternMatcher(pattern), 0, func(node int, _ int) { f(node) })
+}
+
+// PatternSearch は、patternにマッチする全てのキーのノード番号を、キーの辞書順に関数fに返す
+func (trie *LoudsDoubleTrie) PatternSearch(pattern *KeyPattern, f func(node int)) {
+	trie.walkAutomaton(1, newPatternMatcher(pattern), 0, func(node int, _ int) { f(node) })
+}
+
+// PatternSearch は、patternにマッチする全てのキーのノード番号を、キーの辞書順に関数fに返す
+func (trie *LoudsPrefixTrie) PatternSearch(pattern *KeyPattern, f func(node int)) {
+	trie.walkAutomaton(1, newPatternMatcher(pattern), 0, func(node int, _ int) { f(node) })
+}
+
+// PatternSearch は、patternにマッチする全てのキーのノード番号を、キーの辞書順に関数fに返す
+func (trie *LoudsPatriciaTrie) PatternSearch(pattern *KeyPattern, f func(node int)) {
+	trie.walkAutomaton(1, newPatternMatcher(pattern), 0, func(node int, _ int) { f(node) })
+}
+
+// PatternSearch は、UTF-8のバイトを文字にまとめてから、UTF-16の文字でpatternと照合する
+func (adapter *loudsTrieU8Adapter) PatternSearch(pattern *KeyPattern, f func(node int)) {
+	adapter.walkAutomaton(1, newPatternMatcher(pattern), 0, func(node int, _ int) { f(node) })
+}
+
+// PatternSearch は、patternにマッチする全ての読みについて、読みと単語、単語の重みを、
+// 読みの辞書順にコールバック関数fに返す。重みを持たない辞書では、重みは全て0になる
+func (compactDictionary *CompactDictionary) PatternSearch(pattern *KeyPattern, f func(key []uint16, word []uint16, weight uint8)) {
+	if compactDictionary == nil {
+		return
+	}
+	compactDictionary.keyTrie.PatternSearch(pattern, func(node int) {
+		compactDictionary.searchNodeWords(node, f)
+	})
+}
@@ -0,0 +1,96 @@
+package migemo_test
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func TestCompileKeyPattern_Invalid(t *testing.T) {
+	for _, pattern := range []string{"か[き", "か[]", "[こ-か]", "か\\", "[[:kanji:]]", "[[:か行]", "[[:か行:]"} {
+		if _, err := migemo.CompileKeyPattern(pattern); !errors.Is(err, migemo.ErrInvalidKeyPattern) {
+			t.Errorf("%q: expected ErrInvalidKeyPattern, actual:%v", pattern, err)
+		}
+	}
+}
+
+func TestTrie_PatternSearch(t *testing.T) {
+	words := []string{"かい", "かいじ", "かじ", "かんじ", "がんじ", "きょう", "とうきょう", "ときょう", "とっきょ", "\U0001F363じ", "?じ"}
+	sort.Strings(words)
+	keys := make([][]uint16, len(words))
+	isKey := make(map[string]bool)
+	for i, w := range words {
+		keys[i] = utf16.Encode([]rune(w))
+		isKey[w] = true
+	}
+	u8, _ := migemo.BuildLoudsTrieU8(words)
+	tries := map[string]migemo.Trie{"u8": u8.AsTrie()}
+	for _, trieType := range []migemo.TrieType{migemo.TrieTypeLouds, migemo.TrieTypeDouble, migemo.TrieTypePrefix, migemo.TrieTypePatricia} {
+		trie, err := migemo.BuildTrie(trieType, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tries[trieType.String()] = trie
+	}
+	data := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"か?じ", []string{"かいじ", "かんじ"}},
+		{"?じ", []string{"?じ", "かじ", "\U0001F363じ"}},
+		{"\\?じ", []string{"?じ"}},
+		{"と*きょう", []string{"とうきょう", "ときょう"}},
+		{"*きょう", []string{"きょう", "とうきょう", "ときょう"}},
+		{"[かが]?じ", []string{"かいじ", "かんじ", "がんじ"}},
+		{"[^か]?じ", []string{"がんじ"}},
+		{"[か-く]*", []string{"かい", "かいじ", "かじ", "かんじ", "がんじ", "きょう"}},
+		{"とっきょ*", []string{"とっきょ"}},
+		{"[[:か行:]]*", []string{"かい", "かいじ", "かじ", "かんじ", "がんじ", "きょう"}},
+		{"[[:hiragana:]]じ", []string{"かじ"}},
+		{"[^[:hiragana:]]じ", []string{"?じ", "\U0001F363じ"}},
+		{"[[:katakana:]]*", []string{}},
+		{"と[[:た行:]]*", []string{"とっきょ"}},
+		{"[[:さ行:][:た行:]]*", []string{"とうきょう", "ときょう", "とっきょ"}},
+		{"とうきょ", []string{}},
+	}
+	for name, trie := range tries {
+		for _, d := range data {
+			pattern, err := migemo.CompileKeyPattern(d.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := make([]string, 0)
+			trie.PatternSearch(pattern, func(node int) {
+				key := make([]uint16, 0)
+				trie.ReverseLookup(uint32(node), &key)
+				// 内部ノードも返るので、キーだけを比較する
+				if s := string(utf16.Decode(key)); isKey[s] {
+					actual = append(actual, s)
+				}
+			})
+			sort.Strings(actual)
+			if strings.Join(actual, ",") != strings.Join(d.expected, ",") {
+				t.Errorf("%s %q expected:%v actual:%v", name, d.pattern, d.expected, actual)
+			}
+		}
+	}
+}
+
+func TestCompactDictionary_PatternSearch(t *testing.T) {
+	dict := LoadCompactDictionary()
+	pattern, _ := migemo.CompileKeyPattern("と*きょう")
+	found := false
+	dict.PatternSearch(pattern, func(key []uint16, word []uint16, weight uint8) {
+		if !strings.HasPrefix(string(utf16.Decode(key)), "と") {
+			t.Errorf("unexpected key: %s", string(utf16.Decode(key)))
+		}
+		found = found || string(utf16.Decode(word)) == "東京"
+	})
+	if !found {
+		t.Error("東京 is not found")
+	}
+}
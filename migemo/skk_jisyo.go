@@ -0,0 +1,226 @@
+package migemo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SkkCandidate は、SKK辞書の一つの変換候補
+type SkkCandidate struct {
+	Word string
+	// Annotation は、候補の注釈。注釈がなければ空
+	Annotation string
+}
+
+// SkkEntry は、SKK辞書の一行
+type SkkEntry struct {
+	// Reading は、送り仮名の目印の英字を取り除いた読み
+	Reading string
+	// Okuri は、送りありエントリかを示す
+	Okuri      bool
+	Candidates []SkkCandidate
+}
+
+// SkkJisyo は、SKK辞書(SKK-JISYO)を読み込んだもの
+type SkkJisyo struct {
+	Entries []SkkEntry
+	// annotations は、読みと候補から注釈を引く索引。ReadSkkJisyoで作り、なければAnnotationの初回に作る
+	annotations map[string]map[string]string
+}
+
+// ReadSkkJisyo は、SKK辞書を読み込む。ファイルが圧縮されていれば展開する。文字コードはoptions.Encodingで指定し、省略すると自動で判定する。
+// optionsがnilでなければ、読み込み中に発生した警告をoptions.Warningsに追加する
+func ReadSkkJisyo(fp io.Reader, options *BuildOptions) (*SkkJisyo, error) {
+	fp, err := newDecodingReader(fp, options)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	jisyo := &SkkJisyo{}
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if strings.HasPrefix(line, ";") || len(line) == 0 {
+			continue
+		}
+		separator := strings.Index(line, " /")
+		if separator < 0 {
+			if err := options.warn(lineNumber, WarningMalformedLine, line); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entry := SkkEntry{Reading: line[:separator]}
+		if len(entry.Reading) == 0 || strings.Contains(entry.Reading, "#") {
+			// 数値変換のエントリは、正規表現の生成に使えないため読み飛ばす
+			if err := options.warn(lineNumber, WarningSkippedKey, entry.Reading); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if last := entry.Reading[len(entry.Reading)-1]; 'a' <= last && last <= 'z' && len(entry.Reading) > 1 && entry.Reading[len(entry.Reading)-2] >= 0x80 {
+			entry.Reading = entry.Reading[:len(entry.Reading)-1]
+			entry.Okuri = true
+		}
+		for _, field := range splitSkkCandidates(line[separator+2:]) {
+			if len(field) == 0 {
+				continue
+			}
+			var candidate SkkCandidate
+			if semicolon := strings.Index(field, ";"); semicolon >= 0 {
+				candidate.Word = field[:semicolon]
+				candidate.Annotation = field[semicolon+1:]
+			} else {
+				candidate.Word = field
+			}
+			word, ok := decodeSkkConcat(candidate.Word)
+			annotation, annotationOk := decodeSkkConcat(candidate.Annotation)
+			if !ok || !annotationOk || len(word) == 0 {
+				if err := options.warn(lineNumber, WarningUnsupportedCandidate, entry.Reading); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			candidate.Word = word
+			candidate.Annotation = annotation
+			entry.Candidates = append(entry.Candidates, candidate)
+		}
+		if len(entry.Candidates) == 0 {
+			if err := options.warn(lineNumber, WarningEmptyValue, entry.Reading); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		jisyo.Entries = append(jisyo.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", lineNumber+1, err)
+	}
+	jisyo.indexAnnotations()
+	return jisyo, nil
+}
+
+// splitSkkCandidates は、"/候補1/候補2/"の形式の文字列を候補に分割する。
+// 送りありエントリの"[る/送/]"のような送り仮名毎の候補は読み飛ばす
+func splitSkkCandidates(s string) []string {
+	fields := strings.Split(strings.TrimSuffix(s, "/"), "/")
+	candidates := fields[:0]
+	inBlock := false
+	for _, field := range fields {
+		if inBlock {
+			inBlock = field != "]"
+			continue
+		}
+		if strings.HasPrefix(field, "[") {
+			inBlock = true
+			continue
+		}
+		candidates = append(candidates, field)
+	}
+	return candidates
+}
+
+// decodeSkkConcat は、"(concat \"...\")"の形式で書かれた候補を展開する。
+// それ以外のLisp式は展開できないため、falseを返す
+func decodeSkkConcat(s string) (string, bool) {
+	if !strings.HasPrefix(s, "(") {
+		return s, true
+	}
+	if !strings.HasPrefix(s, "(concat ") || !strings.HasSuffix(s, ")") {
+		return "", false
+	}
+	var builder strings.Builder
+	rest := strings.TrimSpace(s[len("(concat ") : len(s)-1])
+	for len(rest) > 0 {
+		if rest[0] != '"' {
+			return "", false
+		}
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			return "", false
+		}
+		// Emacs Lispの8進数エスケープはGoの文字列リテラルと同じ形式
+		part, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return "", false
+		}
+		builder.WriteString(part)
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+	return builder.String(), true
+}
+
+// indexAnnotations は、注釈を持つ候補を読み毎にまとめる。同じ読みと候補が複数あれば、先に現れた注釈を使う
+func (jisyo *SkkJisyo) indexAnnotations() {
+	jisyo.annotations = make(map[string]map[string]string)
+	for _, entry := range jisyo.Entries {
+		for _, candidate := range entry.Candidates {
+			if len(candidate.Annotation) == 0 {
+				continue
+			}
+			words, ok := jisyo.annotations[entry.Reading]
+			if !ok {
+				words = make(map[string]string)
+				jisyo.annotations[entry.Reading] = words
+			}
+			if _, ok := words[candidate.Word]; !ok {
+				words[candidate.Word] = candidate.Annotation
+			}
+		}
+	}
+}
+
+// Annotation は、読みreadingの候補wordの注釈を返す。
+// 索引は初めて呼び出したときのEntriesから作るため、その後にEntriesを変更しても反映されない
+func (jisyo *SkkJisyo) Annotation(reading string, word string) (string, bool) {
+	if jisyo.annotations == nil {
+		jisyo.indexAnnotations()
+	}
+	annotation, ok := jisyo.annotations[reading][word]
+	return annotation, ok
+}
+
+// Build は、SKK辞書からCompactDictionaryを生成する。
+// 送りありと送りなしのエントリで読みが同じものは、一つの読みにまとめる
+func (jisyo *SkkJisyo) Build() (*CompactDictionary, error) {
+	return jisyo.build(TrieTypeDouble)
+}
+
+func (jisyo *SkkJisyo) build(trieType TrieType) (*CompactDictionary, error) {
+	keys := make([]string, 0, len(jisyo.Entries))
+	dict := make(map[string][]string, len(jisyo.Entries))
+	for _, entry := range jisyo.Entries {
+		words, ok := dict[entry.Reading]
+		if !ok {
+			keys = append(keys, entry.Reading)
+		}
+		for _, candidate := range entry.Candidates {
+			if !containsString(words, candidate.Word) {
+				words = append(words, candidate.Word)
+			}
+		}
+		dict[entry.Reading] = words
+	}
+	return buildCompactDictionary(keys, dict, nil, trieType)
+}
+
+// BuildDictionaryFromSkkJisyoFile は、SKK辞書からCompactDictionaryを生成する。
+// トライの種類はoptions.TrieTypeで指定する。候補の注釈が必要な場合は、ReadSkkJisyoとSkkJisyo.Buildを使う
+func BuildDictionaryFromSkkJisyoFile(fp io.Reader, options *BuildOptions) (*CompactDictionary, error) {
+	jisyo, err := ReadSkkJisyo(fp, options)
+	if err != nil {
+		return nil, err
+	}
+	return jisyo.build(options.trieType())
+}
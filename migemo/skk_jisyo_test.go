@@ -0,0 +1,77 @@
+package migemo_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func TestSkkJisyo(t *testing.T) {
+	text := ";; -*- fundamental -*-\n" +
+		";; okuri-ari entries.\n" +
+		"おくr /送/贈;gift/[る/送/贈/]/\n" +
+		";; okuri-nashi entries.\n" +
+		"おく /奥/億;100000000/\n" +
+		"かんじ /漢字;kanji/幹事/\n" +
+		"すらっしゅ /(concat \"\\057\")/(format-time-string \"%Y\")/\n" +
+		"#がつ /#1月/\n" +
+		"broken line\n" +
+		"VS /VS Code/\n"
+	options := &migemo.BuildOptions{}
+	jisyo, err := migemo.ReadSkkJisyo(strings.NewReader(text), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jisyo.Entries) != 5 || !jisyo.Entries[0].Okuri || jisyo.Entries[0].Reading != "おく" {
+		t.Errorf("invalid entries: %v", jisyo.Entries)
+	}
+	kinds := []migemo.BuildWarningKind{}
+	for _, w := range options.Warnings {
+		kinds = append(kinds, w.Kind)
+	}
+	expectedKinds := []migemo.BuildWarningKind{migemo.WarningUnsupportedCandidate, migemo.WarningSkippedKey, migemo.WarningMalformedLine}
+	if len(kinds) != len(expectedKinds) {
+		t.Fatalf("expected:%v actual:%v", expectedKinds, options.Warnings)
+	}
+	for i := range kinds {
+		if kinds[i] != expectedKinds[i] {
+			t.Errorf("expected:%v actual:%v", expectedKinds, options.Warnings)
+		}
+	}
+	if annotation, ok := jisyo.Annotation("おく", "億"); !ok || annotation != "100000000" {
+		t.Errorf("invalid annotation: %q", annotation)
+	}
+	if _, ok := jisyo.Annotation("かんじ", "幹事"); ok {
+		t.Error("unexpected annotation")
+	}
+	if annotation, ok := jisyo.Annotation("おく", "贈"); !ok || annotation != "gift" {
+		t.Errorf("invalid annotation of okuri-ari entry: %q", annotation)
+	}
+	// ReadSkkJisyoを使わずに作った辞書でも注釈を引ける
+	built := &migemo.SkkJisyo{Entries: jisyo.Entries}
+	if annotation, ok := built.Annotation("かんじ", "漢字"); !ok || annotation != "kanji" {
+		t.Errorf("invalid annotation: %q", annotation)
+	}
+
+	dict, err := jisyo.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases := map[string]string{
+		"おく":    "億 奥 贈 送",
+		"かんじ":   "幹事 漢字",
+		"すらっしゅ": "/",
+		"VS":    "VS Code",
+	}
+	for key, expected := range testcases {
+		if actual := strings.Join(collectWords(dict.Search, key), " "); actual != expected {
+			t.Errorf("key:%s expected:%q actual:%q", key, expected, actual)
+		}
+	}
+
+	_, err = migemo.BuildDictionaryFromSkkJisyoFile(strings.NewReader(text), &migemo.BuildOptions{Strict: true})
+	if err == nil {
+		t.Error("strict mode must fail")
+	}
+}
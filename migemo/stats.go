@@ -0,0 +1,366 @@
+package migemo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// statsPrefixLength は、Statsで候補の多い接頭辞を調べる最大の長さ
+	statsPrefixLength = 3
+	// statsPrefixCount は、Statsで長さ毎に報告する接頭辞の数
+	statsPrefixCount = 10
+)
+
+// TrieStats は、トライの構成要素毎の容量(バイト)と形状の統計。
+// LoudsDoubleTrie以外では、対応する構成要素を持たない項目は0になる
+type TrieStats struct {
+	// Type は、トライの種類
+	Type string `json:"type"`
+	// Nodes は、Prefixトライのノード数
+	Nodes int `json:"nodes"`
+	// TailNodes は、Tailトライのノード数
+	TailNodes int `json:"tailNodes"`
+	// EdgesBytes は、Prefixトライのラベルの容量
+	EdgesBytes int `json:"edgesBytes"`
+	// LoudsBitsBytes は、PrefixトライのLOUDSビット列の容量
+	LoudsBitsBytes int `json:"loudsBitsBytes"`
+	// RankIndexBytes は、PrefixトライのLOUDSビット列、outs、linkBitVectorのRank/Select索引の容量
+	RankIndexBytes int `json:"rankIndexBytes"`
+	// OutsBytes は、outsのビット列の容量
+	OutsBytes int `json:"outsBytes"`
+	// TailTrieBytes は、Tailトライ全体(ラベル、ビット列、索引)の容量。LoudsPrefixTrieとLoudsPatriciaTrieではTailの容量
+	TailTrieBytes int `json:"tailTrieBytes"`
+	// LinkArrayBytes は、linkArrayとlinkBitVectorのビット列の容量。LoudsPrefixTrieとLoudsPatriciaTrieではlinksのビット列の容量
+	LinkArrayBytes int `json:"linkArrayBytes"`
+	// TotalBytes は、上記の合計
+	TotalBytes int `json:"totalBytes"`
+	// DepthHistogram は、深さ毎のPrefixトライのノード数。根の深さは0
+	DepthHistogram []int `json:"depthHistogram"`
+	// BranchingHistogram は、子の数毎のPrefixトライのノード数
+	BranchingHistogram []int `json:"branchingHistogram"`
+	// TailLengthHistogram は、長さ毎のTailへのリンクの数
+	TailLengthHistogram []int `json:"tailLengthHistogram"`
+}
+
+// MappingStats は、読みから単語へのマッピングの容量(バイト)と統計
+type MappingStats struct {
+	// MappingBytes は、mappingの容量
+	MappingBytes int `json:"mappingBytes"`
+	// BitVectorBytes は、mappingBitVectorのビット列と索引の容量
+	BitVectorBytes int `json:"bitVectorBytes"`
+	// HasMappingBytes は、hasMappingBitListの容量
+	HasMappingBytes int `json:"hasMappingBytes"`
+	// WeightsBytes は、単語の重みの容量
+	WeightsBytes int `json:"weightsBytes"`
+	// TotalBytes は、上記の合計
+	TotalBytes int `json:"totalBytes"`
+	// Keys は、単語を持つ読みの数
+	Keys int `json:"keys"`
+	// Candidates は、全ての読みの単語の数の合計
+	Candidates int `json:"candidates"`
+	// CandidatesHistogram は、単語の数毎の読みの数
+	CandidatesHistogram []int `json:"candidatesHistogram"`
+}
+
+// PrefixStats は、ある接頭辞で前方一致検索したときの単語の数
+type PrefixStats struct {
+	Prefix     string `json:"prefix"`
+	Candidates int    `json:"candidates"`
+}
+
+// DictionaryStats は、CompactDictionaryの統計
+type DictionaryStats struct {
+	Key        TrieStats    `json:"key"`
+	Value      TrieStats    `json:"value"`
+	Mapping    MappingStats `json:"mapping"`
+	TotalBytes int          `json:"totalBytes"`
+	// HeaviestPrefixes は、長さ毎に前方一致検索の単語が多い接頭辞を、長さの昇順、単語の数の降順に並べたもの
+	HeaviestPrefixes []PrefixStats `json:"heaviestPrefixes"`
+}
+
+// Stats は、辞書の構成要素毎の容量と、トライの形状の統計を返す
+func (compactDictionary *CompactDictionary) Stats() *DictionaryStats {
+	stats := &DictionaryStats{
+		Key:     trieStats(compactDictionary.keyTrie),
+		Value:   trieStats(compactDictionary.valueTrie),
+		Mapping: compactDictionary.mappingStats(),
+	}
+	stats.TotalBytes = stats.Key.TotalBytes + stats.Value.TotalBytes + stats.Mapping.TotalBytes
+	stats.HeaviestPrefixes = compactDictionary.heaviestPrefixes()
+	return stats
+}
+
+func bitVectorBytes(bitVector *BitVector) (int, int) {
+	return len(bitVector.words) * 8, len(bitVector.lb)*4 + len(bitVector.sb)*2 + (len(bitVector.select0Hints)+len(bitVector.select1Hints))*4
+}
+
+func loudsTrieBytes(trie *LoudsTrieU16) int {
+	bits, index := bitVectorBytes(trie.bitVector)
+	return len(trie.edges)*2 + bits + index
+}
+
+// histogramAdd は、ヒストグラムhのvalueの数を1増やす
+func histogramAdd(h []int, value int) []int {
+	for len(h) <= value {
+		h = append(h, 0)
+	}
+	h[value]++
+	return h
+}
+
+// loudsTrieDepths は、LOUDSトライの全てのノードの深さを返す。ノード番号は幅優先順なので、親は子より先に現れる
+func loudsTrieDepths(trie *LoudsTrieU16) []int {
+	depths := make([]int, len(trie.edges))
+	for i := 2; i < len(trie.edges); i++ {
+		depths[i] = depths[trie.Parent(uint32(i))] + 1
+	}
+	return depths
+}
+
+// trieStats は、トライの種類に応じて統計を求める
+func trieStats(trie Trie) TrieStats {
+	var stats TrieStats
+	switch trie := trie.(type) {
+	case *LoudsTrieU16:
+		stats = loudsTrieStats(trie)
+	case *LoudsDoubleTrie:
+		stats = loudsDoubleTrieStats(trie)
+	case *LoudsPrefixTrie:
+		stats = loudsTailTrieStats(trie.trie, trie.outs, trie.links, trie.tail)
+	case *LoudsPatriciaTrie:
+		stats = loudsTailTrieStats(trie.trie, trie.outs, trie.links, trie.tail)
+	default:
+		stats = TrieStats{
+			Nodes:      trie.Size() + 1,
+			TotalBytes: trie.IoSize(),
+		}
+	}
+	stats.Type = trieTypeOf(trie).String()
+	return stats
+}
+
+// addLoudsTrieShape は、LOUDSトライの深さと子の数のヒストグラムをstatsに追加する
+func addLoudsTrieShape(stats *TrieStats, trie *LoudsTrieU16) {
+	depths := loudsTrieDepths(trie)
+	children := make([]int, len(depths))
+	for i := 1; i < len(depths); i++ {
+		stats.DepthHistogram = histogramAdd(stats.DepthHistogram, depths[i])
+		if i >= 2 {
+			children[trie.Parent(uint32(i))]++
+		}
+	}
+	for i := 1; i < len(children); i++ {
+		stats.BranchingHistogram = histogramAdd(stats.BranchingHistogram, children[i])
+	}
+}
+
+func loudsTrieStats(trie *LoudsTrieU16) TrieStats {
+	bits, index := bitVectorBytes(trie.bitVector)
+	stats := TrieStats{
+		Nodes:          trie.Size() + 1,
+		EdgesBytes:     len(trie.edges) * 2,
+		LoudsBitsBytes: bits,
+		RankIndexBytes: index,
+	}
+	stats.TotalBytes = stats.EdgesBytes + stats.LoudsBitsBytes + stats.RankIndexBytes
+	addLoudsTrieShape(&stats, trie)
+	return stats
+}
+
+func loudsDoubleTrieStats(trie *LoudsDoubleTrie) TrieStats {
+	prefixBits, prefixIndex := bitVectorBytes(trie.prefixTrie.bitVector)
+	outsBits, outsIndex := bitVectorBytes(trie.outs)
+	linkBits, linkIndex := bitVectorBytes(trie.linkBitVector)
+	stats := TrieStats{
+		Nodes:          trie.prefixTrie.Size() + 1,
+		TailNodes:      trie.tailTrie.Size() + 1,
+		EdgesBytes:     len(trie.prefixTrie.edges) * 2,
+		LoudsBitsBytes: prefixBits,
+		RankIndexBytes: prefixIndex + outsIndex + linkIndex,
+		OutsBytes:      outsBits,
+		TailTrieBytes:  loudsTrieBytes(trie.tailTrie),
+		LinkArrayBytes: len(trie.linkArray)*4 + linkBits,
+	}
+	stats.TotalBytes = stats.EdgesBytes + stats.LoudsBitsBytes + stats.RankIndexBytes + stats.OutsBytes + stats.TailTrieBytes + stats.LinkArrayBytes
+	addLoudsTrieShape(&stats, trie.prefixTrie)
+	tailDepths := loudsTrieDepths(trie.tailTrie)
+	for _, link := range trie.linkArray {
+		stats.TailLengthHistogram = histogramAdd(stats.TailLengthHistogram, tailDepths[link])
+	}
+	return stats
+}
+
+// loudsTailTrieStats は、TAIL配列を持つLoudsPrefixTrieとLoudsPatriciaTrieの統計を求める
+func loudsTailTrieStats(trie *LoudsTrieU16, outs *BitVector, links *BitVector, tail *Tail) TrieStats {
+	loudsBits, loudsIndex := bitVectorBytes(trie.bitVector)
+	outsBits, outsIndex := bitVectorBytes(outs)
+	linkBits, linkIndex := bitVectorBytes(links)
+	startsBits, startsIndex := bitVectorBytes(tail.starts)
+	sharedBits, sharedIndex := bitVectorBytes(tail.shared)
+	stats := TrieStats{
+		Nodes:          trie.Size() + 1,
+		EdgesBytes:     len(trie.edges) * 2,
+		LoudsBitsBytes: loudsBits,
+		RankIndexBytes: loudsIndex + outsIndex + linkIndex,
+		OutsBytes:      outsBits,
+		TailTrieBytes:  len(tail.chars)*2 + startsBits + startsIndex + sharedBits + sharedIndex + len(tail.offsets)*4,
+		LinkArrayBytes: linkBits,
+	}
+	stats.TotalBytes = stats.EdgesBytes + stats.LoudsBitsBytes + stats.RankIndexBytes + stats.OutsBytes + stats.TailTrieBytes + stats.LinkArrayBytes
+	addLoudsTrieShape(&stats, trie)
+	for i := 0; i < tail.Len(); i++ {
+		stats.TailLengthHistogram = histogramAdd(stats.TailLengthHistogram, len(tail.Get(i)))
+	}
+	return stats
+}
+
+// candidateCounts は、キーのノード毎の単語の数を返す
+func (compactDictionary *CompactDictionary) candidateCounts() []int {
+	counts := make([]int, compactDictionary.keyTrie.Size()+2)
+	node := 0
+	size := uint32(compactDictionary.mappingBitVector.Size())
+	for pos := uint32(0); pos < size; pos++ {
+		if !compactDictionary.mappingBitVector.Get(pos) {
+			node++
+		} else if node < len(counts) {
+			counts[node]++
+		}
+	}
+	return counts
+}
+
+func (compactDictionary *CompactDictionary) mappingStats() MappingStats {
+	bits, index := bitVectorBytes(compactDictionary.mappingBitVector)
+	stats := MappingStats{
+		MappingBytes:    len(compactDictionary.mapping) * 4,
+		BitVectorBytes:  bits + index,
+		HasMappingBytes: len(compactDictionary.hasMappingBitList.Words) * 8,
+		WeightsBytes:    len(compactDictionary.weights),
+		Candidates:      len(compactDictionary.mapping),
+	}
+	stats.TotalBytes = stats.MappingBytes + stats.BitVectorBytes + stats.HasMappingBytes + stats.WeightsBytes
+	for _, count := range compactDictionary.candidateCounts()[1:] {
+		if count > 0 {
+			stats.Keys++
+			stats.CandidatesHistogram = histogramAdd(stats.CandidatesHistogram, count)
+		}
+	}
+	return stats
+}
+
+// heaviestPrefixes は、長さstatsPrefixLengthまでの接頭辞のうち、前方一致検索の単語が多いものを返す
+func (compactDictionary *CompactDictionary) heaviestPrefixes() []PrefixStats {
+	type prefixCount struct {
+		prefix     []uint16
+		candidates int
+	}
+	// 単語を持つ全ての読みについて、その接頭辞に単語の数を足し合わせる
+	prefixes := make([]map[string]*prefixCount, statsPrefixLength+1)
+	for length := range prefixes {
+		prefixes[length] = make(map[string]*prefixCount)
+	}
+	key := make([]uint16, 0, 16)
+	for node, count := range compactDictionary.candidateCounts() {
+		if node < 2 || count == 0 {
+			continue
+		}
+		key = key[:0]
+		compactDictionary.keyTrie.ReverseLookup(uint32(node), &key)
+		for length := 1; length <= statsPrefixLength && length <= len(key); length++ {
+			s := string(utf16.Decode(key[:length]))
+			if p, ok := prefixes[length][s]; ok {
+				p.candidates += count
+			} else {
+				prefixes[length][s] = &prefixCount{append([]uint16{}, key[:length]...), count}
+			}
+		}
+	}
+	result := make([]PrefixStats, 0, statsPrefixLength*statsPrefixCount)
+	for length := 1; length <= statsPrefixLength; length++ {
+		list := make([]*prefixCount, 0, len(prefixes[length]))
+		for _, p := range prefixes[length] {
+			list = append(list, p)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].candidates != list[j].candidates {
+				return list[i].candidates > list[j].candidates
+			}
+			return CompareUtf16String(list[i].prefix, list[j].prefix) < 0
+		})
+		if len(list) > statsPrefixCount {
+			list = list[:statsPrefixCount]
+		}
+		for _, p := range list {
+			result = append(result, PrefixStats{
+				Prefix:     string(utf16.Decode(p.prefix)),
+				Candidates: p.candidates,
+			})
+		}
+	}
+	return result
+}
+
+func formatHistogram(h []int) string {
+	fields := make([]string, 0, len(h))
+	for value, count := range h {
+		if count > 0 {
+			fields = append(fields, fmt.Sprintf("%d:%d", value, count))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+func writeTrieStats(w io.Writer, name string, stats *TrieStats) error {
+	_, err := fmt.Fprintf(w, "%s trie (%s): %d nodes, %d tail nodes, %d bytes\n"+
+		"  edges:       %10d bytes\n"+
+		"  LOUDS bits:  %10d bytes\n"+
+		"  rank index:  %10d bytes\n"+
+		"  outs:        %10d bytes\n"+
+		"  tail trie:   %10d bytes\n"+
+		"  link array:  %10d bytes\n"+
+		"  depth:       %s\n"+
+		"  branching:   %s\n"+
+		"  tail length: %s\n",
+		name, stats.Type, stats.Nodes, stats.TailNodes, stats.TotalBytes,
+		stats.EdgesBytes, stats.LoudsBitsBytes, stats.RankIndexBytes, stats.OutsBytes, stats.TailTrieBytes, stats.LinkArrayBytes,
+		formatHistogram(stats.DepthHistogram), formatHistogram(stats.BranchingHistogram), formatHistogram(stats.TailLengthHistogram))
+	return err
+}
+
+// WriteText は、統計を人が読める形式でwに書き込む。ヒストグラムは"値:数"を空白で区切って表す
+func (stats *DictionaryStats) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "total: %d bytes\n", stats.TotalBytes); err != nil {
+		return err
+	}
+	if err := writeTrieStats(w, "key", &stats.Key); err != nil {
+		return err
+	}
+	if err := writeTrieStats(w, "value", &stats.Value); err != nil {
+		return err
+	}
+	mapping := &stats.Mapping
+	if _, err := fmt.Fprintf(w, "mapping: %d keys, %d candidates, %d bytes\n"+
+		"  mapping:     %10d bytes\n"+
+		"  bit vector:  %10d bytes\n"+
+		"  has mapping: %10d bytes\n"+
+		"  weights:     %10d bytes\n"+
+		"  candidates per key: %s\n",
+		mapping.Keys, mapping.Candidates, mapping.TotalBytes,
+		mapping.MappingBytes, mapping.BitVectorBytes, mapping.HasMappingBytes, mapping.WeightsBytes,
+		formatHistogram(mapping.CandidatesHistogram)); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "heaviest prefixes:"); err != nil {
+		return err
+	}
+	for _, prefix := range stats.HeaviestPrefixes {
+		if _, err := fmt.Fprintf(w, "  %s\t%d\n", prefix.Prefix, prefix.Candidates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
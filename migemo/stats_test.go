@@ -0,0 +1,47 @@
+package migemo_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func TestCompactDictionary_Stats(t *testing.T) {
+	text := "かな\t仮名\t金\t哉\n" +
+		"かなさんどう\t金山堂\n" +
+		"かに\t蟹\n" +
+		"とうきょう\t東京\t東響\n"
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := dict.Stats()
+	if stats.Mapping.Keys != 4 || stats.Mapping.Candidates != 7 {
+		t.Errorf("keys:%d candidates:%d", stats.Mapping.Keys, stats.Mapping.Candidates)
+	}
+	if h := stats.Mapping.CandidatesHistogram; len(h) != 4 || h[1] != 2 || h[2] != 1 || h[3] != 1 {
+		t.Errorf("invalid candidates histogram: %v", h)
+	}
+	if stats.HeaviestPrefixes[0] != (migemo.PrefixStats{Prefix: "か", Candidates: 5}) {
+		t.Errorf("invalid heaviest prefix: %v", stats.HeaviestPrefixes)
+	}
+	if stats.TotalBytes != stats.Key.TotalBytes+stats.Value.TotalBytes+stats.Mapping.TotalBytes || stats.Key.EdgesBytes == 0 {
+		t.Errorf("invalid sizes: %+v", stats)
+	}
+
+	var buf bytes.Buffer
+	if err := stats.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "candidates per key: 1:2 2:1 3:1") {
+		t.Errorf("invalid text output:\n%s", buf.String())
+	}
+	var decoded migemo.DictionaryStats
+	data, _ := json.Marshal(stats)
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Mapping.Candidates != 7 {
+		t.Errorf("invalid JSON output: %s", data)
+	}
+}
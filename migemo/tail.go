@@ -1,24 +1,167 @@
 package migemo
 
-// Tail は、末尾文字列を効率的に格納する
+import (
+	"sort"
+)
+
+// TailMatch は、Tail.Matchの比較結果
+type TailMatch int
+
+const (
+	// TailMismatch は、文字列がTAILと一致しないことを示す
+	TailMismatch TailMatch = iota
+	// TailPartial は、文字列がTAILの途中で終わることを示す
+	TailPartial
+	// TailMatched は、文字列がTAIL全体で始まることを示す
+	TailMatched
+)
+
+// tailMinSharedLength は、文字を共有するTAILの最小の長さ。
+// 共有するTAILは4バイトの開始位置を持つので、短いTAILは共有するより格納したほうが小さい
+const tailMinSharedLength = 3
+
+// Tail は、末尾文字列を効率的に格納する。
+// 他のTAILの接尾辞になっているTAILは文字を格納せず、そのTAILの文字を共有する
 type Tail struct {
-	bits  *BitVector
+	// chars は、共有しないTAILの文字を、TAILの番号順に連結したもの
 	chars []uint16
+	// starts は、charsのうちTAILの先頭の文字の位置に1を立てたもの。末尾の番兵として位置len(chars)にも1を立てる
+	starts *BitVector
+	// shared は、TAIL毎に、文字を共有するかを格納する
+	shared *BitVector
+	// offsets は、文字を共有するTAILの、charsにおける開始位置。空のTAILはlen(chars)
+	offsets []uint32
+}
+
+// BuildTail は、TAILの配列からTailを作成する。TAILの番号は、tailsにおける位置と同じ
+func BuildTail(tails [][]uint16) *Tail {
+	// 逆順の文字列で並べると、接尾辞を共有できるTAILが隣り合う
+	order := make([]int, len(tails))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return compareReversedUtf16String(tails[order[i]], tails[order[j]]) < 0
+	})
+	// containers[i]は、TAIL iの文字を格納するTAILの番号、positions[i]はその中の位置
+	containers := make([]int, len(tails))
+	positions := make([]int, len(tails))
+	for k := len(order) - 1; k >= 0; k-- {
+		i := order[k]
+		containers[i] = i
+		if k+1 < len(order) && len(tails[i]) >= tailMinSharedLength {
+			// 直後のTAILの接尾辞であれば、その末尾を共有する
+			next := order[k+1]
+			if hasUtf16Suffix(tails[next], tails[i]) {
+				containers[i] = containers[next]
+				positions[i] = positions[next] + len(tails[next]) - len(tails[i])
+			}
+		}
+	}
+	chars := make([]uint16, 0)
+	startList := NewBitList()
+	sharedList := NewBitList()
+	starts := make([]int, len(tails))
+	for i, tail := range tails {
+		stored := containers[i] == i && len(tail) > 0
+		sharedList.Add(!stored)
+		if stored {
+			starts[i] = len(chars)
+			chars = append(chars, tail...)
+			startList.Add(true)
+			for j := 1; j < len(tail); j++ {
+				startList.Add(false)
+			}
+		}
+	}
+	startList.Add(true)
+	offsets := make([]uint32, 0)
+	for i, tail := range tails {
+		if len(tail) == 0 {
+			offsets = append(offsets, uint32(len(chars)))
+		} else if containers[i] != i {
+			offsets = append(offsets, uint32(starts[containers[i]]+positions[i]))
+		}
+	}
+	return &Tail{
+		chars:   chars,
+		starts:  NewBitVector(startList.Words, uint32(startList.Size)),
+		shared:  NewBitVector(sharedList.Words, uint32(sharedList.Size)),
+		offsets: offsets,
+	}
 }
 
-// Get is ...
+func compareReversedUtf16String(a []uint16, b []uint16) int {
+	for i, j := len(a)-1, len(b)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if a[i] != b[j] {
+			if a[i] < b[j] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+func hasUtf16Suffix(s []uint16, suffix []uint16) bool {
+	if len(s) < len(suffix) {
+		return false
+	}
+	offset := len(s) - len(suffix)
+	for i, c := range suffix {
+		if s[offset+i] != c {
+			return false
+		}
+	}
+	return true
+}
+
+// Len は、TAILの個数を返す
+func (tail *Tail) Len() int {
+	return tail.shared.Size()
+}
+
+// Get は、index番目のTAILを返す。indexが範囲外ならnil
 func (tail *Tail) Get(index int) []uint16 {
-	tailStart := tail.bits.Select(uint32(index), false)
-	tailEnd := tail.bits.NextClearBit(tailStart+1) - 1
-	tailSize := tailEnd - tailStart
-	tailOffset := tail.bits.Rank(tailStart, true)
-	return tail.chars[tailOffset : tailOffset+tailSize]
+	if index < 0 || tail.Len() <= index {
+		return nil
+	}
+	var start uint
+	if tail.shared.Get(uint32(index)) {
+		start = uint(tail.offsets[tail.shared.Rank(uint(index), true)])
+	} else {
+		start = tail.starts.Select(uint32(tail.shared.Rank(uint(index), false))+1, true)
+	}
+	if start >= uint(len(tail.chars)) {
+		return tail.chars[len(tail.chars):]
+	}
+	end := tail.starts.NextSetBit(start + 1)
+	if end > uint(len(tail.chars)) {
+		end = uint(len(tail.chars))
+	}
+	return tail.chars[start:end]
 }
 
-func (tail *Tail) Match(index int, s []uint16) int {
-	return 0
+// Match は、index番目のTAILとsの先頭を比較し、一致した文字数と比較結果を返す。
+// sがTAIL全体で始まればTailMatched、sがTAILの途中で終わればTailPartialを返す。
+// indexが範囲外ならTailMismatch
+func (tail *Tail) Match(index int, s []uint16) (int, TailMatch) {
+	if index < 0 || tail.Len() <= index {
+		return 0, TailMismatch
+	}
+	t := tail.Get(index)
+	for i, c := range t {
+		if i == len(s) {
+			return i, TailPartial
+		}
+		if s[i] != c {
+			return i, TailMismatch
+		}
+	}
+	return len(t), TailMatched
 }
 
-func BuildTail(tails [][]uint16) *Tail {
-	return nil
+// IoSize is ...
+func (tail *Tail) IoSize() int {
+	return IoSizeUint16Array(tail.chars) + tail.starts.IoSize() + tail.shared.IoSize() + IoSizeUint32Array(tail.offsets)
 }
@@ -0,0 +1,60 @@
+package migemo_test
+
+import (
+	"testing"
+	"unicode/utf16"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func buildTail(words ...string) *migemo.Tail {
+	tails := make([][]uint16, len(words))
+	for i, w := range words {
+		tails[i] = utf16.Encode([]rune(w))
+	}
+	return migemo.BuildTail(tails)
+}
+
+func TestTail_Get(t *testing.T) {
+	words := []string{"dance", "ce", "nce", "", "ance", "x", "nce", "きょう", "とうきょう", "ce"}
+	tail := buildTail(words...)
+	if tail.Len() != len(words) {
+		t.Errorf("expected:%d actual:%d", len(words), tail.Len())
+	}
+	for i, w := range words {
+		if actual := string(utf16.Decode(tail.Get(i))); actual != w {
+			t.Errorf("index:%d expected:%q actual:%q", i, w, actual)
+		}
+	}
+	if tail.Get(-1) != nil || tail.Get(len(words)) != nil {
+		t.Error("out of range index must return nil")
+	}
+	if shared, unshared := buildTail("とうきょう", "うきょう"), buildTail("とうきょう", "おおさか"); shared.IoSize() >= unshared.IoSize() {
+		t.Errorf("suffix is not shared. shared:%d unshared:%d", shared.IoSize(), unshared.IoSize())
+	}
+}
+
+func TestTail_Match(t *testing.T) {
+	tail := buildTail("ance", "", "ce")
+	data := []struct {
+		index  int
+		s      string
+		n      int
+		status migemo.TailMatch
+	}{
+		{0, "ance", 4, migemo.TailMatched},
+		{0, "ances", 4, migemo.TailMatched},
+		{0, "an", 2, migemo.TailPartial},
+		{0, "", 0, migemo.TailPartial},
+		{0, "and", 2, migemo.TailMismatch},
+		{1, "abc", 0, migemo.TailMatched},
+		{2, "ce", 2, migemo.TailMatched},
+		{3, "ce", 0, migemo.TailMismatch},
+	}
+	for _, d := range data {
+		n, status := tail.Match(d.index, utf16.Encode([]rune(d.s)))
+		if n != d.n || status != d.status {
+			t.Errorf("index:%d s:%q expected:(%d,%d) actual:(%d,%d)", d.index, d.s, d.n, d.status, n, status)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package migemo
+
+import (
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Trie は、UTF-16の文字列をキーとするトライの共通のインターフェース。
+// ノード番号は根を1とする幅優先順の番号で、1からSize()+1までの値をとる
+type Trie interface {
+	// Lookup は、keyのノード番号を返す。見つからなければ-1。
+	// TAILを持つトライで、keyがTAILの途中で終わる場合は、そのノード番号を負にして返す
+	Lookup(key []uint16) int
+	// CommonPrefixSearch は、keyの接頭辞になっている全てのキーについて、その長さとノード番号を短い順に関数fに返す
+	CommonPrefixSearch(key []uint16, f func(keyLen int, node int))
+	// ReverseLookup は、ノード番号nodeからキーを復元してkeyの末尾に追加し、追加した文字数を返す
+	ReverseLookup(node uint32, key *[]uint16) int
+	// PredictiveSearchBreadthFirst は、指定したノードから葉の方向に全てのノードを幅優先で巡る
+	PredictiveSearchBreadthFirst(node int, f func(int))
+	// PredictiveSearchOrdered は、指定したノードから葉の方向に全てのノードを、キーの辞書順に巡る。
+	// fがfalseを返したら打ち切り、trueを返す
+	PredictiveSearchOrdered(node int, f func(int) bool) bool
+	// FuzzySearch は、keyとの編集距離がmaxDistance以下の全てのキーについて、そのノード番号と編集距離をキーの辞書順に関数fに返す
+	FuzzySearch(key []uint16, maxDistance int, f func(node int, distance int))
+	// PatternSearch は、patternにマッチする全てのキーのノード番号を、キーの辞書順に関数fに返す
+	PatternSearch(pattern *KeyPattern, f func(node int))
+	// Size は、ノード番号の最大値から1を引いた値を返す
+	Size() int
+	// NumOfNodes は、TAILを格納するトライも含めた全てのノードの個数を返す
+	NumOfNodes() int
+	// IoSize は、トライを格納するのに必要なバイト数を返す
+	IoSize() int
+	// predictiveSearchBreadthFirstUntil は、PredictiveSearchBreadthFirstと同じ順にノードを巡り、fがfalseを返したら打ち切る。
+	// 打ち切った場合はtrueを返す
+	predictiveSearchBreadthFirstUntil(node int, f func(int) bool) bool
+	// walkAutomaton は、nodeの子孫のうち、automatonが受理するキーのノード番号とその深さを、キーの辞書順に関数fに返す
+	walkAutomaton(node int, automaton trieAutomaton, depth int, f func(node int, depth int))
+}
+
+var (
+	_ Trie = (*LoudsTrieU16)(nil)
+	_ Trie = (*LoudsDoubleTrie)(nil)
+	_ Trie = (*LoudsPrefixTrie)(nil)
+	_ Trie = (*LoudsPatriciaTrie)(nil)
+	_ Trie = (*loudsTrieU8Adapter)(nil)
+)
+
+// BuildTrie は、ソート済みのkeysから、trieTypeで指定した種類のトライを作成する
+func BuildTrie(trieType TrieType, keys [][]uint16) (Trie, error) {
+	switch trieType {
+	case TrieTypeLouds:
+		trie, _ := BuildLoudsTrie(keys)
+		return trie, nil
+	case TrieTypeDouble:
+		trie, _ := BuildLoudsDoubleTrie(keys)
+		return trie, nil
+	case TrieTypePrefix:
+		trie, _ := BuildLoudsPrefixTrie(keys)
+		return trie, nil
+	case TrieTypePatricia:
+		trie, _ := BuildLoudsPatriciaTrie(keys)
+		return trie, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedTrieType, trieType)
+}
+
+// trieTypeOf は、トライの種類を返す。辞書ファイルに格納できない種類なら0
+func trieTypeOf(trie Trie) TrieType {
+	switch trie.(type) {
+	case *LoudsTrieU16:
+		return TrieTypeLouds
+	case *LoudsDoubleTrie:
+		return TrieTypeDouble
+	case *LoudsPrefixTrie:
+		return TrieTypePrefix
+	case *LoudsPatriciaTrie:
+		return TrieTypePatricia
+	}
+	return 0
+}
+
+// loudsTrieU8Adapter は、UTF-8のバイトをラベルとするLoudsTrieU8を、UTF-16のキーで引けるようにする
+type loudsTrieU8Adapter struct {
+	trie *LoudsTrieU8
+}
+
+// AsTrie は、UTF-16のキーをUTF-8に変換して引くTrieを返す。
+// ノード番号はLoudsTrieU8のものをそのまま使うので、文字の途中のバイトに対応するノードも含まれる
+func (trie *LoudsTrieU8) AsTrie() Trie {
+	return &loudsTrieU8Adapter{trie}
+}
+
+func (adapter *loudsTrieU8Adapter) Lookup(key []uint16) int {
+	b := make([]uint8, 0, len(key)*3)
+	for _, r := range utf16.Decode(key) {
+		var buf [utf8.UTFMax]uint8
+		n := utf8.EncodeRune(buf[:], r)
+		b = append(b, buf[:n]...)
+	}
+	return adapter.trie.Lookup(b)
+}
+
+func (adapter *loudsTrieU8Adapter) CommonPrefixSearch(key []uint16, f func(keyLen int, node int)) {
+	// UTF-8のバイト数毎に、UTF-16での長さを記録する。文字の途中のバイトは-1
+	b := make([]uint8, 0, len(key)*3)
+	lengths := make([]int, 1, len(key)*3+1)
+	keyLen := 0
+	for _, r := range utf16.Decode(key) {
+		var buf [utf8.UTFMax]uint8
+		n := utf8.EncodeRune(buf[:], r)
+		b = append(b, buf[:n]...)
+		if r >= 0x10000 {
+			keyLen += 2
+		} else {
+			keyLen++
+		}
+		for i := 1; i < n; i++ {
+			lengths = append(lengths, -1)
+		}
+		lengths = append(lengths, keyLen)
+	}
+	adapter.trie.CommonPrefixSearch(b, func(byteLen int, node int) {
+		if lengths[byteLen] >= 0 {
+			f(lengths[byteLen], node)
+		}
+	})
+}
+
+func (adapter *loudsTrieU8Adapter) ReverseLookup(node uint32, key *[]uint16) int {
+	b := make([]uint8, 0, 16)
+	adapter.trie.ReverseLookup(node, &b)
+	offset := len(*key)
+	*key = append(*key, utf16.Encode([]rune(string(b)))...)
+	return len(*key) - offset
+}
+
+func (adapter *loudsTrieU8Adapter) PredictiveSearchBreadthFirst(node int, f func(int)) {
+	adapter.trie.PredictiveSearchBreadthFirst(node, f)
+}
+
+// PredictiveSearchOrdered は、UTF-8のバイト順にノードを巡る。
+// サロゲートペアで表す文字とU+E000以降の文字の順序は、UTF-16の辞書順と異なる
+func (adapter *loudsTrieU8Adapter) PredictiveSearchOrdered(node int, f func(int) bool) bool {
+	return adapter.trie.PredictiveSearchOrdered(node, f)
+}
+
+func (adapter *loudsTrieU8Adapter) predictiveSearchBreadthFirstUntil(node int, f func(int) bool) bool {
+	return adapter.trie.predictiveSearchBreadthFirstUntil(node, f)
+}
+
+func (adapter *loudsTrieU8Adapter) Size() int {
+	return adapter.trie.Size()
+}
+
+func (adapter *loudsTrieU8Adapter) NumOfNodes() int {
+	return adapter.trie.Size()
+}
+
+func (adapter *loudsTrieU8Adapter) IoSize() int {
+	return adapter.trie.IoSize()
+}
@@ -0,0 +1,159 @@
+package migemo
+
+import (
+	"unicode/utf8"
+)
+
+// trieAutomaton は、トライを深さ優先でたどりながら、キーを一文字ずつ受け取って判定する。
+// 深さは根からのUTF-16の文字数
+type trieAutomaton interface {
+	// push は、深さdepthまでの文字列に文字cを追加する。さらに文字を追加して受理しうるならtrue
+	push(depth int, c uint16) bool
+	// accepts は、深さdepthまでの文字列を受理するかを返す。受理するなら、直前のpushはtrueを返している
+	accepts(depth int) bool
+}
+
+// boundedAutomaton は、automatonに渡す文字数をmaxNodesまでに制限する。
+// 制限に達した後のpushは全てfalseを返すので、トライをたどる処理はそれ以上子孫に進まない
+type boundedAutomaton struct {
+	trieAutomaton
+	// maxNodes は、pushできる文字数の上限。0以下なら制限しない
+	maxNodes  int
+	visited   int
+	truncated bool
+}
+
+func (automaton *boundedAutomaton) push(depth int, c uint16) bool {
+	if automaton.maxNodes > 0 && automaton.visited >= automaton.maxNodes {
+		automaton.truncated = true
+		return false
+	}
+	automaton.visited++
+	return automaton.trieAutomaton.push(depth, c)
+}
+
+// childRange は、ノードnodeの子のノード番号の範囲[first, end)を返す
+func (trie *LoudsTrieU16) childRange(node int) (int, int) {
+	pos := trie.bitVector.Select(uint32(node), false) + 1
+	end := trie.bitVector.NextClearBit(pos)
+	if end <= pos {
+		return 0, 0
+	}
+	first := int(trie.bitVector.Rank(pos, true)) + 1
+	return first, first + int(end-pos)
+}
+
+// walkAutomaton は、nodeの子孫のうち、automatonが受理するキーのノード番号とその深さを、キーの辞書順に関数fに返す
+func (trie *LoudsTrieU16) walkAutomaton(node int, automaton trieAutomaton, depth int, f func(node int, depth int)) {
+	first, end := trie.childRange(node)
+	for child := first; child < end; child++ {
+		if !automaton.push(depth, trie.edges[child]) {
+			continue
+		}
+		if automaton.accepts(depth + 1) {
+			f(child, depth+1)
+		}
+		trie.walkAutomaton(child, automaton, depth+1, f)
+	}
+}
+
+func (trie *LoudsDoubleTrie) walkAutomaton(node int, automaton trieAutomaton, depth int, f func(node int, depth int)) {
+	first, end := trie.prefixTrie.childRange(node)
+	for child := first; child < end; child++ {
+		if !automaton.push(depth, trie.prefixTrie.edges[child]) {
+			continue
+		}
+		d := depth + 1
+		if !trie.linkBitVector.Get(uint32(child)) {
+			if automaton.accepts(d) {
+				f(child, d)
+			}
+			trie.walkAutomaton(child, automaton, d, f)
+			continue
+		}
+		// Tailを持つノードは葉なので、Tailの末尾まで進めてから判定する
+		alive := true
+		tailNode := trie.linkArray[trie.linkBitVector.Rank(uint(child), true)]
+		for ; tailNode > 1 && alive; d++ {
+			alive = automaton.push(d, trie.tailTrie.edges[tailNode])
+			tailNode = trie.tailTrie.Parent(tailNode)
+		}
+		if alive && automaton.accepts(d) {
+			f(child, d)
+		}
+	}
+}
+
+// walkTailTrieAutomaton は、Tailを持つLoudsPrefixTrieとLoudsPatriciaTrieをautomatonでたどる。
+// Tailを持つノードでは、Tailの末尾まで進めてから判定し、子があればさらにたどる
+func walkTailTrieAutomaton(trie *LoudsTrieU16, links *BitVector, tail *Tail, node int, automaton trieAutomaton, depth int, f func(node int, depth int)) {
+	first, end := trie.childRange(node)
+	for child := first; child < end; child++ {
+		alive := automaton.push(depth, trie.edges[child])
+		d := depth + 1
+		if alive && links.Get(uint32(child)) {
+			for _, c := range tail.Get(int(links.Rank(uint(child), true))) {
+				if alive = automaton.push(d, c); !alive {
+					break
+				}
+				d++
+			}
+		}
+		if !alive {
+			continue
+		}
+		if automaton.accepts(d) {
+			f(child, d)
+		}
+		walkTailTrieAutomaton(trie, links, tail, child, automaton, d, f)
+	}
+}
+
+func (trie *LoudsPrefixTrie) walkAutomaton(node int, automaton trieAutomaton, depth int, f func(node int, depth int)) {
+	walkTailTrieAutomaton(trie.trie, trie.links, trie.tail, node, automaton, depth, f)
+}
+
+func (trie *LoudsPatriciaTrie) walkAutomaton(node int, automaton trieAutomaton, depth int, f func(node int, depth int)) {
+	walkTailTrieAutomaton(trie.trie, trie.links, trie.tail, node, automaton, depth, f)
+}
+
+// walkAutomaton は、UTF-8のバイトを文字にまとめてから、UTF-16の文字をautomatonに渡す
+func (adapter *loudsTrieU8Adapter) walkAutomaton(node int, automaton trieAutomaton, depth int, f func(node int, depth int)) {
+	adapter.walkAutomatonU8(node, automaton, depth, nil, f)
+}
+
+func (adapter *loudsTrieU8Adapter) walkAutomatonU8(node int, automaton trieAutomaton, depth int, pending []uint8, f func(int, int)) {
+	trie := adapter.trie
+	pos := trie.bitVector.Select(uint32(node), false) + 1
+	end := trie.bitVector.NextClearBit(pos)
+	if end <= pos {
+		return
+	}
+	first := int(trie.bitVector.Rank(pos, true)) + 1
+	for child := first; child < first+int(end-pos); child++ {
+		b := append(pending, trie.edges[child])
+		if !utf8.FullRune(b) {
+			// 文字の途中のバイトなので、判定せずに子をたどる
+			adapter.walkAutomatonU8(child, automaton, depth, b, f)
+			continue
+		}
+		r, _ := utf8.DecodeRune(b)
+		alive := true
+		d := depth
+		if r >= 0x10000 {
+			r -= 0x10000
+			alive = automaton.push(d, uint16(0xd800+(r>>10))) && automaton.push(d+1, uint16(0xdc00+(r&0x3ff)))
+			d += 2
+		} else {
+			alive = automaton.push(d, uint16(r))
+			d++
+		}
+		if !alive {
+			continue
+		}
+		if automaton.accepts(d) {
+			f(child, d)
+		}
+		adapter.walkAutomatonU8(child, automaton, d, nil, f)
+	}
+}
@@ -0,0 +1,41 @@
+package migemo_test
+
+import (
+	"testing"
+	"unicode/utf16"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func TestLoudsTrieU8_AsTrie(t *testing.T) {
+	words := []string{"かな", "かなさんどう", "とうきょう", "東京"}
+	u8, _ := migemo.BuildLoudsTrieU8(words)
+	var trie migemo.Trie = u8.AsTrie()
+	for _, word := range words {
+		node := trie.Lookup(utf16.Encode([]rune(word)))
+		if node < 0 {
+			t.Errorf("%s is not found", word)
+			continue
+		}
+		key := make([]uint16, 0)
+		n := trie.ReverseLookup(uint32(node), &key)
+		if actual := string(utf16.Decode(key)); actual != word || n != len(key) {
+			t.Errorf("expected:%s actual:%s (%d)", word, actual, n)
+		}
+	}
+	if node := trie.Lookup(utf16.Encode([]rune("かなた"))); node != -1 {
+		t.Errorf("expected:-1 actual:%d", node)
+	}
+}
+
+func TestLoudsTrieU8_AsTrie_CommonPrefixSearch(t *testing.T) {
+	u8, _ := migemo.BuildLoudsTrieU8([]string{"a", "aあ", "aあ\U0001F363"})
+	trie := u8.AsTrie()
+	lengths := []int{}
+	trie.CommonPrefixSearch(utf16.Encode([]rune("aあ\U0001F363b")), func(keyLen int, node int) {
+		lengths = append(lengths, keyLen)
+	})
+	if len(lengths) != 3 || lengths[0] != 1 || lengths[1] != 2 || lengths[2] != 4 {
+		t.Errorf("expected:[1 2 4] actual:%v", lengths)
+	}
+}
@@ -0,0 +1,334 @@
+package migemo
+
+import (
+	"fmt"
+	"math/bits"
+	"unicode/utf16"
+)
+
+// VerifyIssue は、Verifyで見つかった一つの不整合
+type VerifyIssue struct {
+	// Component は、不整合の見つかった構造の名前。例えば"keyTrie.linkArray"や"mapping"
+	Component string
+	// Offset は、その構造における要素の位置。ノードの不整合ではノード番号
+	Offset  int
+	Message string
+}
+
+func (issue VerifyIssue) String() string {
+	return fmt.Sprintf("%s[%d]: %s", issue.Component, issue.Offset, issue.Message)
+}
+
+// VerifyError は、Verifyで見つかった全ての不整合
+type VerifyError struct {
+	Issues []VerifyIssue
+}
+
+func (err *VerifyError) Error() string {
+	if len(err.Issues) == 1 {
+		return "migemo: inconsistent dictionary: " + err.Issues[0].String()
+	}
+	return fmt.Sprintf("migemo: inconsistent dictionary: %s (and %d more issues)", err.Issues[0], len(err.Issues)-1)
+}
+
+type verifier struct {
+	issues []VerifyIssue
+}
+
+func (v *verifier) report(component string, offset int, format string, args ...interface{}) {
+	v.issues = append(v.issues, VerifyIssue{
+		Component: component,
+		Offset:    offset,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// run は、検査fを実行する。壊れた辞書の検査中にパニックした場合は、不整合として報告する
+func (v *verifier) run(component string, f func() bool) (ok bool) {
+	count := len(v.issues)
+	defer func() {
+		if r := recover(); r != nil {
+			v.report(component, -1, "panic during verification: %v", r)
+			ok = false
+		}
+	}()
+	return f() && count == len(v.issues)
+}
+
+// Verify は、辞書の内部構造が整合しているかを検査する。
+// 不整合が見つかった場合は、全ての不整合を格納した*VerifyErrorを返す
+func (compactDictionary *CompactDictionary) Verify() error {
+	v := &verifier{}
+	keyOk := v.run("keyTrie", func() bool { return v.verifyTrie("keyTrie", compactDictionary.keyTrie) })
+	valueOk := v.run("valueTrie", func() bool { return v.verifyTrie("valueTrie", compactDictionary.valueTrie) })
+	if keyOk && valueOk {
+		v.run("mapping", func() bool { return v.verifyMapping(compactDictionary) })
+	}
+	if len(v.issues) > 0 {
+		return &VerifyError{v.issues}
+	}
+	return nil
+}
+
+// countOnes は、ビット配列の1の数を返す
+func countOnes(bitVector *BitVector) int {
+	count := 0
+	for i, w := range bitVector.words {
+		if rest := int(bitVector.sizeInBits) - i*64; rest < 64 {
+			w &= (uint64(1) << uint(rest)) - 1
+		}
+		count += bits.OnesCount64(w)
+	}
+	return count
+}
+
+// verifyTrie は、トライの種類に応じて構造を検査したあと、全てのノードのキーを検査する
+func (v *verifier) verifyTrie(name string, trie Trie) bool {
+	switch trie := trie.(type) {
+	case nil:
+		v.report(name, 0, "trie is missing")
+		return false
+	case *LoudsTrieU16:
+		if !v.verifyLoudsTrie(name, trie) {
+			return false
+		}
+	case *LoudsDoubleTrie:
+		if !v.verifyLoudsDoubleTrie(name, trie) {
+			return false
+		}
+	case *LoudsPrefixTrie:
+		if trie == nil || !v.verifyLoudsTailTrie(name, trie.trie, trie.outs, trie.links, trie.tail) {
+			return false
+		}
+	case *LoudsPatriciaTrie:
+		if trie == nil || !v.verifyLoudsTailTrie(name, trie.trie, trie.outs, trie.links, trie.tail) {
+			return false
+		}
+	}
+	if len(v.issues) > 0 {
+		return false
+	}
+	// 全てのノードについて、ReverseLookupで復元したキーをLookupすると元のノードに戻ることを確かめる
+	key := make([]uint16, 0, 16)
+	for i := 2; i < trie.Size()+2; i++ {
+		key = key[:0]
+		trie.ReverseLookup(uint32(i), &key)
+		if found := trie.Lookup(key); found != i {
+			v.report(name, i, "key %q is looked up as node %d", string(utf16.Decode(key)), found)
+		}
+	}
+	return true
+}
+
+func (v *verifier) verifyLoudsTrie(name string, trie *LoudsTrieU16) bool {
+	if trie == nil || trie.bitVector == nil {
+		v.report(name, 0, "trie is missing")
+		return false
+	}
+	return v.verifyLoudsShape(name+".bitVector", trie.bitVector, len(trie.edges)-1)
+}
+
+// verifyLoudsShape は、LOUDSのビット列がnodes個のノードの木を表すかを検査する。
+// 先頭が"10"で、0の個数が根を除くノード数+1、全てのノードの親がそのノードより前にあることを確かめる。
+// これを満たせば、ReverseLookupで親をたどると必ず根に着く。
+// キーを持たないトライは、根だけを表す"1"の1ビットで格納するので、そのまま受け入れる
+func (v *verifier) verifyLoudsShape(name string, bitVector *BitVector, nodes int) bool {
+	if !v.verifyBitVector(name, bitVector) {
+		return false
+	}
+	size := bitVector.Size()
+	if size == 1 && bitVector.Get(0) && nodes == 1 {
+		return true
+	}
+	if size < 2 || !bitVector.Get(0) || bitVector.Get(1) {
+		v.report(name, 0, "does not start with 10")
+		return false
+	}
+	ones, zeros := 0, 0
+	for i := 0; i < size; i++ {
+		if !bitVector.Get(uint32(i)) {
+			zeros++
+			continue
+		}
+		ones++
+		// ones番目のノードの親は、それまでの0の個数と同じ番号のノード
+		if ones > 1 && zeros >= ones {
+			v.report(name, i, "parent %d of node %d is not before the node", zeros, ones)
+			return false
+		}
+	}
+	if ones != nodes {
+		v.report(name, ones, "has %d nodes, but edges has %d labels", ones, nodes)
+		return false
+	}
+	if zeros != nodes {
+		v.report(name, zeros, "has %d zeros for %d nodes", zeros, nodes)
+		return false
+	}
+	return true
+}
+
+// verifyBitVector は、BitVectorのRankの索引がビット配列と一致するかを検査する。
+// メモリマップ形式の辞書は索引をファイルから読み込むので、一致しなければSelectが正しい位置を返さない
+func (v *verifier) verifyBitVector(name string, bitVector *BitVector) bool {
+	expected := NewBitVector(bitVector.words, bitVector.sizeInBits)
+	if expected == nil || len(expected.lb) != len(bitVector.lb) || len(expected.sb) != len(bitVector.sb) {
+		v.report(name, len(bitVector.words), "has %d words for %d bits", len(bitVector.words), bitVector.sizeInBits)
+		return false
+	}
+	for i := range expected.lb {
+		if expected.lb[i] != bitVector.lb[i] {
+			v.report(name+".lb", i, "rank %d does not match the bits (%d)", bitVector.lb[i], expected.lb[i])
+			return false
+		}
+	}
+	for i := range expected.sb {
+		if expected.sb[i] != bitVector.sb[i] {
+			v.report(name+".sb", i, "rank %d does not match the bits (%d)", bitVector.sb[i], expected.sb[i])
+			return false
+		}
+	}
+	return true
+}
+
+func (v *verifier) verifyLoudsDoubleTrie(name string, trie *LoudsDoubleTrie) bool {
+	if trie == nil || trie.outs == nil || trie.linkBitVector == nil {
+		v.report(name, 0, "trie is missing")
+		return false
+	}
+	if !v.verifyLoudsTrie(name+".prefixTrie", trie.prefixTrie) || !v.verifyLoudsTrie(name+".tailTrie", trie.tailTrie) ||
+		!v.verifyBitVector(name+".outs", trie.outs) || !v.verifyBitVector(name+".linkBitVector", trie.linkBitVector) {
+		return false
+	}
+	nodes := trie.prefixTrie.Size() + 2
+	if trie.linkBitVector.Size() < nodes {
+		v.report(name+".linkBitVector", trie.linkBitVector.Size(), "is shorter than %d nodes", nodes)
+		return false
+	}
+	if ones := countOnes(trie.linkBitVector); ones != len(trie.linkArray) {
+		v.report(name+".linkBitVector", ones, "has %d links, but linkArray has %d entries", ones, len(trie.linkArray))
+		return false
+	}
+	tailNodes := trie.tailTrie.Size() + 1
+	for i, link := range trie.linkArray {
+		if link < 2 || int(link) > tailNodes {
+			v.report(name+".linkArray", i, "tail node %d is out of range [2, %d]", link, tailNodes)
+		}
+	}
+	return true
+}
+
+// verifyLoudsTailTrie は、Tailを持つLoudsPrefixTrieとLoudsPatriciaTrieの構造を検査する
+func (v *verifier) verifyLoudsTailTrie(name string, trie *LoudsTrieU16, outs *BitVector, links *BitVector, tail *Tail) bool {
+	if outs == nil || links == nil || tail == nil || tail.starts == nil || tail.shared == nil {
+		v.report(name, 0, "trie is missing")
+		return false
+	}
+	if !v.verifyLoudsTrie(name+".trie", trie) || !v.verifyBitVector(name+".outs", outs) || !v.verifyBitVector(name+".links", links) {
+		return false
+	}
+	nodes := trie.Size() + 2
+	if links.Size() < nodes {
+		v.report(name+".links", links.Size(), "is shorter than %d nodes", nodes)
+		return false
+	}
+	if ones := countOnes(links); ones != tail.Len() {
+		v.report(name+".links", ones, "has %d links, but tail has %d entries", ones, tail.Len())
+		return false
+	}
+	return v.verifyTail(name+".tail", tail)
+}
+
+func (v *verifier) verifyTail(name string, tail *Tail) bool {
+	if !v.verifyBitVector(name+".starts", tail.starts) || !v.verifyBitVector(name+".shared", tail.shared) {
+		return false
+	}
+	size := len(tail.chars)
+	if tail.starts.Size() != size+1 || !tail.starts.Get(uint32(size)) {
+		v.report(name+".starts", tail.starts.Size(), "does not end with a sentinel at %d", size)
+		return false
+	}
+	stored := tail.Len() - countOnes(tail.shared)
+	if ones := countOnes(tail.starts); ones != stored+1 {
+		v.report(name+".starts", ones, "has %d tails, but shared has %d unshared tails", ones-1, stored)
+		return false
+	}
+	if shared := countOnes(tail.shared); shared != len(tail.offsets) {
+		v.report(name+".shared", shared, "has %d shared tails, but offsets has %d entries", shared, len(tail.offsets))
+		return false
+	}
+	for i, offset := range tail.offsets {
+		if int(offset) > size {
+			v.report(name+".offsets", i, "offset %d is out of range [0, %d]", offset, size)
+		}
+	}
+	return true
+}
+
+// trieOuts は、ノードがキーの末尾であるかを格納したビット配列を返す。トライが持たなければnil。
+// LoudsTrieU16は持たないので、キーの途中のノードとキーの末尾のノードを見分けられない
+func trieOuts(trie Trie) *BitVector {
+	switch trie := trie.(type) {
+	case *LoudsDoubleTrie:
+		return trie.outs
+	case *LoudsPrefixTrie:
+		return trie.outs
+	case *LoudsPatriciaTrie:
+		return trie.outs
+	}
+	return nil
+}
+
+func (v *verifier) verifyMapping(compactDictionary *CompactDictionary) bool {
+	mappingBitVector := compactDictionary.mappingBitVector
+	if mappingBitVector == nil || compactDictionary.hasMappingBitList == nil {
+		v.report("mapping", 0, "mapping is missing")
+		return false
+	}
+	if !v.verifyBitVector("mappingBitVector", mappingBitVector) {
+		return false
+	}
+	ones := countOnes(mappingBitVector)
+	zeros := mappingBitVector.Size() - ones
+	if keyNodes := compactDictionary.keyTrie.Size() + 1; zeros != keyNodes {
+		v.report("mappingBitVector", zeros, "has %d nodes, but key trie has %d nodes", zeros, keyNodes)
+		return false
+	}
+	if ones != len(compactDictionary.mapping) {
+		v.report("mappingBitVector", ones, "has %d mappings, but mapping has %d entries", ones, len(compactDictionary.mapping))
+		return false
+	}
+	if weights := compactDictionary.weights; weights != nil && len(weights) != len(compactDictionary.mapping) {
+		v.report("weights", len(weights), "has %d weights, but mapping has %d entries", len(weights), len(compactDictionary.mapping))
+	}
+	valueTrie := compactDictionary.valueTrie
+	valueNodes := valueTrie.Size() + 1
+	outs := trieOuts(valueTrie)
+	word := make([]uint16, 0, 16)
+	for i, node := range compactDictionary.mapping {
+		if node < 2 || int(node) > valueNodes {
+			v.report("mapping", i, "value node %d is out of range [2, %d]", node, valueNodes)
+			continue
+		}
+		// 単語の途中のノードを指していれば、ReverseLookupは単語でない文字列を復元する
+		word = word[:0]
+		valueTrie.ReverseLookup(node, &word)
+		if found := valueTrie.Lookup(word); found != int(node) {
+			v.report("mapping", i, "value node %d is looked up as node %d", node, found)
+		} else if outs != nil && !outs.Get(node) {
+			v.report("mapping", i, "value node %d is not the end of a word", node)
+		}
+	}
+	expected := createHasMappingBitList(mappingBitVector)
+	actual := compactDictionary.hasMappingBitList
+	if actual.Size != expected.Size {
+		v.report("hasMappingBitList", actual.Size, "has %d nodes, but mappingBitVector has %d nodes", actual.Size, expected.Size)
+		return false
+	}
+	for i := 0; i < expected.Size; i++ {
+		if actual.Get(i) != expected.Get(i) {
+			v.report("hasMappingBitList", i, "is %t, but mappingBitVector says %t", actual.Get(i), expected.Get(i))
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package migemo_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math/bits"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/oguna/gomigemo-experiments-2020/migemo"
+)
+
+func TestCompactDictionary_Verify(t *testing.T) {
+	if err := LoadCompactDictionary().Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open("../testdata/todofuken.txt")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	dict.WriteTo(&buf)
+	data := buf.Bytes()
+	// mappingは最後に格納されているので、末尾の要素を範囲外のノード番号に書き換えてチェックサムを直す
+	mappings := int(binary.BigEndian.Uint32(data[16:]))
+	binary.BigEndian.PutUint32(data[len(data)-4:], 0xffffff)
+	binary.BigEndian.PutUint32(data[24:], crc32.ChecksumIEEE(data[28:]))
+	broken, err := migemo.NewCompactDictionary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = broken.Verify()
+	var verifyError *migemo.VerifyError
+	if !errors.As(err, &verifyError) {
+		t.Fatalf("expected VerifyError. actual:%v", err)
+	}
+	if len(verifyError.Issues) != 1 || verifyError.Issues[0].Component != "mapping" || verifyError.Issues[0].Offset != mappings-1 {
+		t.Errorf("invalid issues: %v", verifyError.Issues)
+	}
+}
+
+func TestCompactDictionary_Verify_Small(t *testing.T) {
+	testcases := map[string]string{
+		"single": "あ\t亜\n",
+		"shared": "a\tA\nab\tAB\n",
+		"empty":  "",
+	}
+	for _, trieType := range []migemo.TrieType{migemo.TrieTypeLouds, migemo.TrieTypeDouble, migemo.TrieTypePrefix, migemo.TrieTypePatricia} {
+		for name, text := range testcases {
+			dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{TrieType: trieType})
+			if err != nil {
+				t.Fatalf("%s %s: %v", trieType, name, err)
+			}
+			if err := dict.Verify(); err != nil {
+				t.Errorf("%s %s: %v", trieType, name, err)
+			}
+			var buf bytes.Buffer
+			dict.WriteMappableTo(&buf)
+			mapped, err := migemo.NewCompactDictionary(buf.Bytes())
+			if err != nil {
+				t.Fatalf("%s %s: %v", trieType, name, err)
+			}
+			if err := mapped.Verify(); err != nil {
+				t.Errorf("%s %s mapped: %v", trieType, name, err)
+			}
+			for _, key := range []string{"あ", "a", "ab", "b"} {
+				dict.Search(utf16.Encode([]rune(key)), func([]uint16) {})
+				dict.PredictiveSearch(utf16.Encode([]rune(key)), func([]uint16) {})
+			}
+		}
+	}
+}
+
+func TestCompactDictionary_Verify_MappingTarget(t *testing.T) {
+	words := map[string]bool{"東京": true, "東北": true}
+	for _, trieType := range []migemo.TrieType{migemo.TrieTypeDouble, migemo.TrieTypePrefix, migemo.TrieTypePatricia} {
+		dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader("とう\t東京\t東北\n"), &migemo.BuildOptions{TrieType: trieType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		dict.WriteTo(&buf)
+		data := buf.Bytes()
+		valueNodes := binary.BigEndian.Uint32(data[12:])
+		// mappingの末尾の要素を全ての単語のノードに書き換え、単語の途中を指すものがVerifyで見つかることを確かめる
+		for node := uint32(2); node <= valueNodes+1; node++ {
+			binary.BigEndian.PutUint32(data[len(data)-4:], node)
+			binary.BigEndian.PutUint32(data[24:], crc32.ChecksumIEEE(data[28:]))
+			broken, err := migemo.NewCompactDictionary(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			isWord := true
+			broken.Search(utf16.Encode([]rune("とう")), func(word []uint16) {
+				isWord = isWord && words[string(utf16.Decode(word))]
+			})
+			if err := broken.Verify(); (err == nil) != isWord {
+				t.Errorf("%s node %d: word:%t error:%v", trieType, node, isWord, err)
+			}
+		}
+	}
+}
+
+func TestCompactDictionary_Verify_LoudsShape(t *testing.T) {
+	text := "あ\t亜\nい\t胃\nいか\t烏賊\nう\t鵜\n"
+	dict, err := migemo.BuildDictionaryFromMigemoDictFile(strings.NewReader(text), &migemo.BuildOptions{TrieType: migemo.TrieTypeLouds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	dict.WriteTo(&buf)
+	data := buf.Bytes()
+	// キーのトライのラベルの後にあるLOUDSのビット列を、1と0の個数を変えずに"10"+"00…"+"11…"に並べ替える
+	offset := 28 + 4
+	offset += 4 + int(binary.BigEndian.Uint32(data[offset:]))
+	size := binary.BigEndian.Uint32(data[offset:])
+	if size > 64 {
+		t.Fatalf("bit vector is too long: %d", size)
+	}
+	word := binary.BigEndian.Uint64(data[offset+4:])
+	ones := bits.OnesCount64(word)
+	sorted := uint64(1)
+	for i := 0; i < ones-1; i++ {
+		sorted |= uint64(1) << (size - 1 - uint32(i))
+	}
+	binary.BigEndian.PutUint64(data[offset+4:], sorted)
+	binary.BigEndian.PutUint32(data[24:], crc32.ChecksumIEEE(data[28:]))
+	broken, err := migemo.NewCompactDictionary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verifyError *migemo.VerifyError
+	if err := broken.Verify(); !errors.As(err, &verifyError) || verifyError.Issues[0].Component != "keyTrie.bitVector" {
+		t.Fatalf("expected LOUDS shape error. actual:%v", err)
+	}
+	// 検査せずに使っても、ReverseLookupは止まる
+	for _, key := range []string{"あ", "い", "う"} {
+		broken.PredictiveSearch(utf16.Encode([]rune(key)), func([]uint16) {})
+	}
+}